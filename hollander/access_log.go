@@ -0,0 +1,114 @@
+package hollander
+
+import (
+	"fmt"
+	"github.com/happywbfriends/nano/logger"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+type AccessLogFormat int
+
+const (
+	// Поля через logger.ILogger.With (в JSON-логгере - отдельные поля), сообщение "access"
+	AccessLogFields AccessLogFormat = iota
+	// Строка в формате Apache combined, request id - полем логгера
+	AccessLogCombined
+)
+
+/*
+	Настройки access-лога: одна запись на каждый запрос, обслуженный Middleware.
+
+	mw.WithAccessLog(AccessLog{Sample2xx: 100, SlowThreshold: time.Second})
+
+	Ответы 4xx/5xx и медленные запросы логируются всегда, 2xx/3xx - с сэмплированием.
+	Медленные и 5xx пишутся с уровнем Warn, остальные - Info.
+*/
+type AccessLog struct {
+	Log           logger.ILogger // если nil - логгер Middleware
+	Format        AccessLogFormat
+	Sample2xx     uint64        // логировать каждый N-й успешный запрос; 0 и 1 - все
+	SlowThreshold time.Duration // запросы не быстрее этого логируются всегда; 0 - не проверять
+}
+
+type _AccessLogger struct {
+	AccessLog
+	nb2xx uint64 // счетчик для сэмплирования, atomic
+}
+
+// Данные о запросе, которые попадают в лог
+type _AccessRecord struct {
+	r         *http.Request
+	requestId string
+	status    int
+	bytes     int64
+	latency   time.Duration
+	ttfb      time.Duration
+}
+
+func (al *_AccessLogger) write(log logger.ILogger, rec *_AccessRecord) {
+	slow := al.SlowThreshold > 0 && rec.latency >= al.SlowThreshold
+	if rec.status < 400 && !slow && al.Sample2xx > 1 {
+		if atomic.AddUint64(&al.nb2xx, 1)%al.Sample2xx != 1 {
+			return
+		}
+	}
+
+	if al.Log != nil {
+		log = al.Log
+	}
+	log = log.With("x-request-id", rec.requestId)
+
+	msg := "access"
+	if al.Format == AccessLogCombined {
+		msg = combinedLogLine(rec, time.Now())
+	} else {
+		log = log.With("method", rec.r.Method).
+			With("route", RouteTemplate(rec.r)).
+			With("path", rec.r.URL.Path).
+			With("status", strconv.Itoa(rec.status)).
+			With("bytes", strconv.FormatInt(rec.bytes, 10)).
+			With("latency_ms", millis(rec.latency)).
+			With("ttfb_ms", millis(rec.ttfb)).
+			With("remote_addr", rec.r.RemoteAddr).
+			With("user_agent", rec.r.UserAgent())
+		if slow {
+			log = log.With("slow", "true")
+		}
+	}
+
+	if slow || rec.status >= 500 {
+		log.Warnf("%s", msg)
+	} else {
+		log.Infof("%s", msg)
+	}
+}
+
+func millis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+// host - user [time] "request" status bytes "referer" "user-agent"
+func combinedLogLine(rec *_AccessRecord, now time.Time) string {
+	host := stripPort(rec.r.RemoteAddr)
+	if host == "" {
+		host = "-"
+	}
+	user := "-"
+	if u, _, ok := rec.r.BasicAuth(); ok && u != "" {
+		user = u
+	}
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %d %q %q",
+		host, user, now.Format("02/Jan/2006:15:04:05 -0700"),
+		rec.r.Method, rec.r.RequestURI, rec.r.Proto, rec.status, rec.bytes,
+		orDash(rec.r.Referer()), orDash(rec.r.UserAgent()))
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
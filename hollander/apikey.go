@@ -0,0 +1,160 @@
+package hollander
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"github.com/happywbfriends/nano/xerror"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const HeaderApiKey = "X-Api-Key"
+
+// Хранится не сам ключ, а его SHA-256, см. HashAPIKey
+type APIKey struct {
+	Name   string
+	Hash   string // hex SHA-256 ключа
+	Scopes []string
+}
+
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+type APIKeyConfig struct {
+	Header string // по умолчанию HeaderApiKey
+	Query  string // если задан, ключ принимается и в этом query-параметре (хуже: попадает в логи)
+}
+
+/*
+	Аутентификация по API-ключу. Найденный ключ кладет в Values(): имя в ValuePrincipal, права в ValueScopes.
+	Сравниваются хеши, с каждым ключом и за постоянное время, так что по времени ответа ключ не подобрать.
+
+	keys, err := NewAPIKeyAuthFile(APIKeyConfig{}, "/etc/app/api_keys", 10*time.Second)
+	g.Use(keys.Handle).Use(RequireScopes("orders:read"))
+*/
+type APIKeyAuth struct {
+	cfg  APIKeyConfig
+	keys []_APIKeyHash    // если ключи заданы в коде
+	file *_ReloadableFile // иначе []_APIKeyHash из файла
+}
+
+type _APIKeyHash struct {
+	APIKey
+	sum []byte
+}
+
+func NewAPIKeyAuth(cfg APIKeyConfig, keys ...APIKey) (*APIKeyAuth, error) {
+	hashes, err := hashAPIKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+	return &APIKeyAuth{cfg: cfg.withDefaults(), keys: hashes}, nil
+}
+
+/*
+	Ключи из файла, который перечитывается при изменении (проверка не чаще раза в reloadEvery, 0 - не перечитывать).
+	Строка файла: имя, hex SHA-256 ключа и через запятую права, если есть. Пустые строки и # - комментарии:
+
+	# name   sha256(key)                                                       scopes
+	billing  2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae  orders:read,orders:write
+*/
+func NewAPIKeyAuthFile(cfg APIKeyConfig, path string, reloadEvery time.Duration) (*APIKeyAuth, error) {
+	f, err := newReloadableFile(path, reloadEvery, func(data []byte) (interface{}, error) {
+		keys, err := ParseAPIKeys(data)
+		if err != nil {
+			return nil, err
+		}
+		return hashAPIKeys(keys)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &APIKeyAuth{cfg: cfg.withDefaults(), file: f}, nil
+}
+
+func (cfg APIKeyConfig) withDefaults() APIKeyConfig {
+	if cfg.Header == "" {
+		cfg.Header = HeaderApiKey
+	}
+	return cfg
+}
+
+func ParseAPIKeys(data []byte) ([]APIKey, error) {
+	var keys []APIKey
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: expected 'name hash [scopes]'", n)
+		}
+		k := APIKey{Name: fields[0], Hash: fields[1]}
+		if len(fields) == 3 {
+			k.Scopes = strings.Split(fields[2], ",")
+		}
+		keys = append(keys, k)
+	}
+	return keys, sc.Err()
+}
+
+func hashAPIKeys(keys []APIKey) ([]_APIKeyHash, error) {
+	hashes := make([]_APIKeyHash, 0, len(keys))
+	for _, k := range keys {
+		sum, err := hex.DecodeString(k.Hash)
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("API key '%s': hash is not a hex SHA-256", k.Name)
+		}
+		hashes = append(hashes, _APIKeyHash{APIKey: k, sum: sum})
+	}
+	return hashes, nil
+}
+
+// Перечитать файл с ключами немедленно, например по SIGHUP
+func (a *APIKeyAuth) Reload() error {
+	if a.file == nil {
+		return nil
+	}
+	return a.file.load()
+}
+
+func (a *APIKeyAuth) Handle(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+	key := r.Header.Get(a.cfg.Header)
+	if key == "" && a.cfg.Query != "" {
+		key = r.URL.Query().Get(a.cfg.Query)
+	}
+	if key == "" {
+		return false, authFailed(mw, "", "API key required")
+	}
+
+	keys := a.keys
+	if a.file != nil {
+		keys = a.file.get(mw.Log()).([]_APIKeyHash)
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	found := -1
+	for i := range keys {
+		// без break: время не зависит от того, какой по счету ключ совпал
+		if subtle.ConstantTimeCompare(sum[:], keys[i].sum) == 1 {
+			found = i
+		}
+	}
+	if found < 0 {
+		return false, authFailed(mw, "", "Invalid API key")
+	}
+
+	vals := mw.Values()
+	vals[ValuePrincipal] = keys[found].Name
+	vals[ValueScopes] = keys[found].Scopes
+	return true, nil
+}
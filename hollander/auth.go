@@ -0,0 +1,127 @@
+package hollander
+
+import (
+	"github.com/happywbfriends/nano/logger"
+	"github.com/happywbfriends/nano/xerror"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Имя аутентифицированного клиента в IMiddleware.Values(), string: имя API-ключа, пользователь Basic или sub из JWT
+	ValuePrincipal = "principal"
+	// Права клиента в IMiddleware.Values(), []string, см. RequireScopes
+	ValueScopes = "scopes"
+)
+
+// Отказ в аутентификации, считается в HTTPMetrics.NbAuthFailed
+type _AuthFailedError struct {
+	xerror.IError
+}
+
+// challenge - значение WWW-Authenticate, пустое - без заголовка
+func authFailed(mw IMiddleware, challenge, msg string) xerror.IError {
+	if challenge != "" {
+		mw.SetHeader(HeaderWWWAuthenticate, challenge)
+	}
+	return &_AuthFailedError{xerror.NewUnauthorized(msg)}
+}
+
+/*
+	Пропускает дальше только клиентов, у которых в Values()[ValueScopes] есть все перечисленные права,
+	остальным 403. Ставится после APIKeyAuth, JWTAuth или своего HttpHandler-а, заполняющего ValueScopes:
+
+	g.Use(keys.Handle).Use(RequireScopes("orders:write"))
+*/
+func RequireScopes(scopes ...string) HttpHandler {
+	return func(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+		granted, _ := mw.Values()[ValueScopes].([]string)
+		for _, s := range scopes {
+			if !contains(granted, s) {
+				return false, xerror.NewForbidden("Missing scope '" + s + "'")
+			}
+		}
+		return true, nil
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Файл, который перечитывается, если изменился. Проверка ленивая: не чаще раза в every,
+	прямо в запросе, без фоновых горутин. Ошибка перечитывания логируется, остается прежнее содержимое.
+*/
+type _ReloadableFile struct {
+	path    string
+	every   time.Duration
+	parse   func(data []byte) (interface{}, error)
+	current atomic.Value
+	checked int64 // unix nano последней проверки, atomic
+
+	mu      sync.Mutex // под ним только перечитывание
+	modTime time.Time
+	size    int64
+}
+
+// Первое чтение файла: ошибка возвращается, а не логируется
+func newReloadableFile(path string, every time.Duration, parse func(data []byte) (interface{}, error)) (*_ReloadableFile, error) {
+	f := &_ReloadableFile{path: path, every: every, parse: parse}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *_ReloadableFile) get(log logger.ILogger) interface{} {
+	if f.every > 0 {
+		now := time.Now().UnixNano()
+		if now-atomic.LoadInt64(&f.checked) >= int64(f.every) && f.mu.TryLock() {
+			// остальные запросы в это время работают со старым содержимым
+			atomic.StoreInt64(&f.checked, now)
+			if err := f.reload(); err != nil {
+				log.Errorf("Failed reloading %s: %s", f.path, err)
+			}
+			f.mu.Unlock()
+		}
+	}
+	return f.current.Load()
+}
+
+// Принудительно перечитывает файл, например по SIGHUP
+func (f *_ReloadableFile) load() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.modTime = time.Time{}
+	return f.reload()
+}
+
+func (f *_ReloadableFile) reload() error {
+	st, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	if st.ModTime().Equal(f.modTime) && st.Size() == f.size {
+		return nil
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	v, err := f.parse(data)
+	if err != nil {
+		return err
+	}
+	f.current.Store(v)
+	f.modTime, f.size = st.ModTime(), st.Size()
+	return nil
+}
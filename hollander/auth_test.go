@@ -0,0 +1,159 @@
+package hollander
+
+import (
+	"github.com/happywbfriends/nano/logger"
+	"github.com/happywbfriends/nano/xerror"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Middleware с auth и хендлером, отвечающим principal и scopes
+func authMiddleware(ns string, auth ...HttpHandler) *Middleware {
+	mw := NewMiddleware(logger.NoLogger).WithMetrics(ns, "GET /")
+	for _, h := range auth {
+		mw.Use(h)
+	}
+	return mw.Use(func(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+		scopes, _ := mw.Values()[ValueScopes].([]string)
+		mw.SendText(http.StatusOK, mw.Values()[ValuePrincipal].(string)+" "+strings.Join(scopes, ","))
+		return false, nil
+	})
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	keys, err := NewAPIKeyAuth(APIKeyConfig{Query: "api_key"},
+		APIKey{Name: "billing", Hash: HashAPIKey("k1"), Scopes: []string{"orders:read", "orders:write"}},
+		APIKey{Name: "reports", Hash: HashAPIKey("k2"), Scopes: []string{"orders:read"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw := authMiddleware("test_apikey", keys.Handle, RequireScopes("orders:write"))
+
+	serve := func(target, key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		if key != "" {
+			r.Header.Set(HeaderApiKey, key)
+		}
+		w := httptest.NewRecorder()
+		mw.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		target, key string
+		status      int
+		body        string
+	}{
+		{"/", "k1", http.StatusOK, "billing orders:read,orders:write"},
+		{"/?api_key=k1", "", http.StatusOK, "billing orders:read,orders:write"},
+		{"/", "k2", http.StatusForbidden, "Missing scope 'orders:write'"},
+		{"/", "k3", http.StatusUnauthorized, "Invalid API key"},
+		{"/", "", http.StatusUnauthorized, "API key required"},
+	}
+	for _, tt := range tests {
+		w := serve(tt.target, tt.key)
+		if w.Code != tt.status || w.Body.String() != tt.body {
+			t.Errorf("%s key %q: got %d %q, want %d %q", tt.target, tt.key, w.Code, w.Body, tt.status, tt.body)
+		}
+	}
+	if n := testutil.ToFloat64(mw.metrics.NbAuthFailed); n != 2 {
+		t.Errorf("got %v auth failures in metrics, want 2", n)
+	}
+
+	if _, err := NewAPIKeyAuth(APIKeyConfig{}, APIKey{Name: "plain", Hash: "k1"}); err == nil {
+		t.Error("key without hash accepted")
+	}
+}
+
+func TestAPIKeyAuth_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api_keys")
+	write := func(content string, mtime time.Time) {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now()
+	write("# name hash scopes\nbilling "+HashAPIKey("k1")+" orders:read\n", start)
+
+	keys, err := NewAPIKeyAuthFile(APIKeyConfig{}, path, time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw := authMiddleware("test_apikey_reload", keys.Handle)
+	status := func(key string) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(HeaderApiKey, key)
+		w := httptest.NewRecorder()
+		mw.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if status("k1") != http.StatusOK || status("k2") != http.StatusUnauthorized {
+		t.Fatal("initial keys")
+	}
+	write("billing "+HashAPIKey("k2")+"\n", start.Add(time.Second))
+	if status("k1") != http.StatusUnauthorized || status("k2") != http.StatusOK {
+		t.Error("keys were not reloaded")
+	}
+	// битый файл не роняет уже загруженные ключи
+	write("billing\n", start.Add(2*time.Second))
+	if status("k2") != http.StatusOK {
+		t.Error("broken file replaced keys")
+	}
+	if err := keys.Reload(); err == nil {
+		t.Error("Reload accepted broken file")
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	if err := os.WriteFile(path, []byte("alice:"+string(hash)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	auth, err := NewBasicAuthFile("admin", path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw := authMiddleware("test_basic", auth.Handle)
+
+	serve := func(user, password string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if user != "" {
+			r.SetBasicAuth(user, password)
+		}
+		w := httptest.NewRecorder()
+		mw.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < 2; i++ { // второй раз - из кеша проверок
+		if w := serve("alice", "secret"); w.Code != http.StatusOK || w.Body.String() != "alice " {
+			t.Errorf("got %d %q", w.Code, w.Body)
+		}
+	}
+	for _, c := range [][2]string{{"alice", "wrong"}, {"bob", "secret"}, {"", ""}} {
+		w := serve(c[0], c[1])
+		if w.Code != http.StatusUnauthorized || w.Header().Get(HeaderWWWAuthenticate) != `Basic realm="admin", charset="UTF-8"` {
+			t.Errorf("%v: got status %d, headers %v", c, w.Code, w.Header())
+		}
+	}
+	if n := testutil.ToFloat64(mw.metrics.NbAuthFailed); n != 3 {
+		t.Errorf("got %v auth failures in metrics, want 3", n)
+	}
+
+	if _, err := parseHtpasswd([]byte("bob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=")); err == nil {
+		t.Error("non-bcrypt hash accepted")
+	}
+}
@@ -0,0 +1,302 @@
+package hollander
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/happywbfriends/nano/xerror"
+	"github.com/prometheus/client_golang/prometheus"
+	"hash/maphash"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+	Правила бана клиентов, которые слишком часто получают 4xx (перебор путей, паролей, кривые интеграции).
+	Каждый следующий бан вдвое длиннее предыдущего, но не длиннее MaxBanDuration.
+	Если после окончания бана клиент ForgetAfter не попадался, эскалация начинается заново.
+*/
+type BanPolicy struct {
+	Max4xx         int           // сколько 4xx за Window сходит с рук
+	Window         time.Duration // окно подсчета 4xx
+	BanDuration    time.Duration // первый бан
+	MaxBanDuration time.Duration // 0 - без ограничения
+	ForgetAfter    time.Duration // 0 - 24 часа
+	Status         int           // ответ забаненным: 403 (по умолчанию) или 429
+}
+
+/*
+	Учет 4xx по клиентам и баны. Один Banner подключается и к роутеру, и к Middleware:
+
+	banner := NewBanner(BanPolicy{Max4xx: 50, Window: time.Minute, BanDuration: time.Minute}).WithMetrics("api")
+	router.Banner = banner                          // 404/405/415 роутера и отказ забаненным до поиска роута
+	router.Group("/api").WithBanner(banner)         // 4xx, которые вернули HttpHandler-ы
+	router.Mount("/admin/bans", banner.AdminHandler())
+
+	Ответы забаненным клиентам сами в 4xx не засчитываются.
+*/
+type Banner struct {
+	policy  BanPolicy
+	key     func(r *http.Request) string
+	now     func() time.Time
+	seed    maphash.Seed
+	shards  [rateLimitShards]_BanShard
+	metrics *BanMetrics   // nullable
+	banned  xerror.IError // ответ забаненному клиенту из Middleware
+}
+
+type BanMetrics struct {
+	NbBans        prometheus.Counter
+	NbBanRejected prometheus.Counter
+	NbBanned      prometheus.GaugeFunc // сейчас забанено клиентов
+}
+
+type _BanShard struct {
+	mu    sync.Mutex
+	items map[string]*_BanState
+	ops   int
+}
+
+type _BanState struct {
+	windowStart time.Time
+	nb4xx       int
+	bannedUntil time.Time
+	strikes     int // сколько раз банили подряд
+}
+
+// Описание бана для AdminHandler
+type BanInfo struct {
+	Key     string    `json:"key"`
+	Until   time.Time `json:"until"`
+	Strikes int       `json:"strikes"`
+}
+
+func NewBanner(policy BanPolicy) *Banner {
+	if policy.Max4xx <= 0 || policy.Window <= 0 || policy.BanDuration <= 0 {
+		panic(fmt.Sprintf("invalid ban policy %+v", policy))
+	}
+	if policy.ForgetAfter == 0 {
+		policy.ForgetAfter = 24 * time.Hour
+	}
+	if policy.Status == 0 {
+		policy.Status = http.StatusForbidden
+	}
+	b := &Banner{
+		policy: policy,
+		key:    KeyByIP,
+		now:    time.Now,
+		seed:   maphash.MakeSeed(),
+		banned: xerror.NewCustom(policy.Status, 0, bannedMessage),
+	}
+	for i := range b.shards {
+		b.shards[i].items = make(map[string]*_BanState)
+	}
+	return b
+}
+
+// Ключ клиента, по умолчанию IP. Если функция вернула пустую строку, используется IP
+func (b *Banner) WithKey(key func(r *http.Request) string) *Banner {
+	b.key = key
+	return b
+}
+
+func (b *Banner) WithMetrics(ns string) *Banner {
+	b.metrics = &BanMetrics{
+		NbBans:        newCounter(ns, "http_nb_bans", ""),
+		NbBanRejected: newCounter(ns, "http_nb_ban_rejected", ""),
+		NbBanned: newGaugeFunc(ns, "http_nb_banned_clients", func() float64 {
+			return float64(len(b.Bans()))
+		}),
+	}
+	return b
+}
+
+func (b *Banner) clientKey(r *http.Request) string {
+	if key := b.key(r); key != "" {
+		return key
+	}
+	return KeyByIP(r)
+}
+
+func (b *Banner) shard(key string) *_BanShard {
+	var h maphash.Hash
+	h.SetSeed(b.seed)
+	_, _ = h.WriteString(key)
+	return &b.shards[h.Sum64()%rateLimitShards]
+}
+
+// Сколько еще продлится бан клиента, 0 - не забанен
+func (b *Banner) banLeft(r *http.Request) time.Duration {
+	key := b.clientKey(r)
+	sh := b.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if st := sh.items[key]; st != nil {
+		if left := st.bannedUntil.Sub(b.now()); left > 0 {
+			if b.metrics != nil {
+				b.metrics.NbBanRejected.Inc()
+			}
+			return left
+		}
+	}
+	return 0
+}
+
+// Учитывает ответ клиенту; банит, если 4xx стало слишком много
+func (b *Banner) record(r *http.Request, status int) {
+	if status < 400 || status > 499 {
+		return
+	}
+	key := b.clientKey(r)
+	now := b.now()
+	sh := b.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	sh.ops++
+	if sh.ops%rateLimitSweepEvery == 0 {
+		sh.sweep(now, b.policy)
+	}
+
+	st := sh.items[key]
+	if st == nil {
+		st = &_BanState{windowStart: now}
+		sh.items[key] = st
+	}
+	if now.Before(st.bannedUntil) {
+		return
+	}
+	if now.Sub(st.windowStart) > b.policy.Window {
+		st.windowStart, st.nb4xx = now, 0
+	}
+	st.nb4xx++
+	if st.nb4xx > b.policy.Max4xx {
+		b.ban(st, now, 0)
+	}
+}
+
+// d == 0 - длительность по политике с эскалацией
+func (b *Banner) ban(st *_BanState, now time.Time, d time.Duration) {
+	if !st.bannedUntil.IsZero() && now.Sub(st.bannedUntil) > b.policy.ForgetAfter {
+		st.strikes = 0
+	}
+	st.strikes++
+	if d == 0 {
+		d = b.policy.BanDuration
+		// без MaxBanDuration удвоение останавливается перед переполнением
+		for i := 1; i < st.strikes && d <= math.MaxInt64/2 && (b.policy.MaxBanDuration == 0 || d < b.policy.MaxBanDuration); i++ {
+			d *= 2
+		}
+		if b.policy.MaxBanDuration > 0 && d > b.policy.MaxBanDuration {
+			d = b.policy.MaxBanDuration
+		}
+	}
+	st.bannedUntil = now.Add(d)
+	st.nb4xx = 0
+	if b.metrics != nil {
+		b.metrics.NbBans.Inc()
+	}
+}
+
+// Удаляем клиентов, про которых уже можно забыть
+func (sh *_BanShard) sweep(now time.Time, policy BanPolicy) {
+	for k, st := range sh.items {
+		if now.Sub(st.windowStart) > policy.Window && now.Sub(st.bannedUntil) > policy.ForgetAfter {
+			delete(sh.items, k)
+		}
+	}
+}
+
+// Банит клиента вручную на d
+func (b *Banner) Ban(key string, d time.Duration) {
+	now := b.now()
+	sh := b.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	st := sh.items[key]
+	if st == nil {
+		st = &_BanState{windowStart: now}
+		sh.items[key] = st
+	}
+	b.ban(st, now, d)
+}
+
+// Снимает бан и забывает историю клиента. Возвращает, был ли он забанен
+func (b *Banner) Unban(key string) (unbanned bool) {
+	sh := b.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if st := sh.items[key]; st != nil {
+		unbanned = b.now().Before(st.bannedUntil)
+		delete(sh.items, key)
+	}
+	return unbanned
+}
+
+// Действующие баны, по времени окончания
+func (b *Banner) Bans() []BanInfo {
+	now := b.now()
+	bans := []BanInfo{}
+	for i := range b.shards {
+		sh := &b.shards[i]
+		sh.mu.Lock()
+		for k, st := range sh.items {
+			if now.Before(st.bannedUntil) {
+				bans = append(bans, BanInfo{Key: k, Until: st.bannedUntil, Strikes: st.strikes})
+			}
+		}
+		sh.mu.Unlock()
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Until.Before(bans[j].Until) })
+	return bans
+}
+
+/*
+	Управление банами:
+		GET						список действующих банов в JSON
+		POST ?key=..&duration=1h	забанить вручную
+		DELETE ?key=..			разбанить
+	Хендлер сам никак не защищен, его нужно закрывать авторизацией или не выставлять наружу.
+*/
+func (b *Banner) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Query().Get("key")
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			w.Header().Set(HeaderContentType, ContentTypeJSON)
+			if err := json.NewEncoder(w).Encode(b.Bans()); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+		case http.MethodPost:
+			d, err := time.ParseDuration(r.URL.Query().Get("duration"))
+			if key == "" || err != nil || d <= 0 {
+				http.Error(w, "key and positive duration are required", http.StatusBadRequest)
+				return
+			}
+			b.Ban(key, d)
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodDelete:
+			if !b.Unban(key) {
+				http.Error(w, "not banned", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set(HeaderAllow, "DELETE, GET, HEAD, POST")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// Ответ забаненному клиенту из роутера
+func (b *Banner) reject(w http.ResponseWriter, left time.Duration) {
+	w.Header().Set(HeaderRetryAfter, seconds(left))
+	http.Error(w, bannedMessage, b.policy.Status)
+}
+
+const bannedMessage = "Too many failed requests"
@@ -0,0 +1,143 @@
+package hollander
+
+import (
+	"encoding/json"
+	"github.com/happywbfriends/nano/xerror"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBanner(t *testing.T) {
+	now := time.Unix(1000, 0)
+	banner := NewBanner(BanPolicy{Max4xx: 3, Window: time.Minute, BanDuration: time.Minute, MaxBanDuration: 3 * time.Minute}).
+		WithMetrics("test_ban")
+	banner.now = func() time.Time { return now }
+
+	router := NewRouter()
+	router.Banner = banner
+	router.Group("/api").WithBanner(banner).Serve(http.MethodGet, "/secret", func(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+		if r.Header.Get("Authorization") == "" {
+			return false, xerror.NewUnauthorized("no token")
+		}
+		mw.SendText(http.StatusOK, "secret")
+		return false, nil
+	})
+	router.Mount("/admin/bans", banner.AdminHandler())
+
+	serve := func(method, uri, remoteAddr string, authorized bool) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, uri, nil)
+		r.RemoteAddr = remoteAddr
+		if authorized {
+			r.Header.Set("Authorization", "token")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	const client, other = "10.0.0.1:1000", "10.0.0.2:1000"
+
+	// 404 и 405 роутера
+	for _, uri := range []string{"/a", "/b", "/c"} {
+		serve(http.MethodGet, uri, client, false)
+	}
+	if w := serve(http.MethodPost, "/api/secret", client, true); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("got status %d, want 405", w.Code)
+	}
+	w := serve(http.MethodGet, "/api/secret", client, true)
+	if w.Code != http.StatusForbidden || w.Header().Get(HeaderRetryAfter) != "60" {
+		t.Fatalf("expected ban: got status %d, headers %v", w.Code, w.Header())
+	}
+	if w := serve(http.MethodGet, "/api/secret", other, true); w.Code != http.StatusOK {
+		t.Fatalf("other client: got status %d", w.Code)
+	}
+
+	// бан кончился, теперь 4xx от Middleware - второй бан вдвое длиннее
+	now = now.Add(61 * time.Second)
+	for i := 0; i < 4; i++ {
+		if w := serve(http.MethodGet, "/api/secret", client, false); w.Code != http.StatusUnauthorized {
+			t.Fatalf("request %d: got status %d, want 401", i, w.Code)
+		}
+	}
+	if w := serve(http.MethodGet, "/api/secret", client, true); w.Code != http.StatusForbidden || w.Header().Get(HeaderRetryAfter) != "120" {
+		t.Fatalf("expected escalated ban: got status %d, headers %v", w.Code, w.Header())
+	}
+
+	// отказы забаненному не продлевают бан
+	now = now.Add(121 * time.Second)
+	if w := serve(http.MethodGet, "/api/secret", client, true); w.Code != http.StatusOK {
+		t.Fatalf("after ban: got status %d", w.Code)
+	}
+
+	// ручное управление
+	if w := serve(http.MethodPost, "/admin/bans?key=10.0.0.2&duration=1h", client, true); w.Code != http.StatusNoContent {
+		t.Fatalf("manual ban: got status %d", w.Code)
+	}
+	w = serve(http.MethodGet, "/admin/bans", client, true)
+	var bans []BanInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &bans); err != nil || len(bans) != 1 || bans[0].Key != "10.0.0.2" || !bans[0].Until.Equal(now.Add(time.Hour)) {
+		t.Fatalf("got bans %s", w.Body.String())
+	}
+	if w := serve(http.MethodGet, "/api/secret", other, true); w.Code != http.StatusForbidden {
+		t.Fatalf("manually banned client: got status %d", w.Code)
+	}
+	if w := serve(http.MethodDelete, "/admin/bans?key=10.0.0.2", client, true); w.Code != http.StatusNoContent {
+		t.Fatalf("unban: got status %d", w.Code)
+	}
+	if w := serve(http.MethodGet, "/api/secret", other, true); w.Code != http.StatusOK {
+		t.Fatalf("unbanned client: got status %d", w.Code)
+	}
+
+	if n := testutil.ToFloat64(banner.metrics.NbBans); n != 3 {
+		t.Errorf("got %v bans in metrics, want 3", n)
+	}
+	if n := testutil.ToFloat64(banner.metrics.NbBanRejected); n != 3 {
+		t.Errorf("got %v rejections in metrics, want 3", n)
+	}
+}
+
+func TestBanner_Escalation(t *testing.T) {
+	now := time.Unix(1000, 0)
+	banner := NewBanner(BanPolicy{Max4xx: 1, Window: time.Minute, BanDuration: time.Minute, MaxBanDuration: 3 * time.Minute, ForgetAfter: time.Hour})
+	banner.now = func() time.Time { return now }
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	for i, expected := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		banner.record(r, http.StatusNotFound)
+		banner.record(r, http.StatusNotFound)
+		if left := banner.banLeft(r); left != expected {
+			t.Fatalf("ban %d: got %s, want %s", i, left, expected)
+		}
+		now = now.Add(expected)
+	}
+
+	// за ForgetAfter история забывается
+	now = now.Add(2 * time.Hour)
+	banner.record(r, http.StatusNotFound)
+	banner.record(r, http.StatusNotFound)
+	if left := banner.banLeft(r); left != time.Minute {
+		t.Fatalf("got %s after ForgetAfter, want 1m", left)
+	}
+}
+
+// Без MaxBanDuration длительность растет до предела time.Duration, но не переполняется
+func TestBanner_EscalationUnbounded(t *testing.T) {
+	now := time.Unix(1000, 0)
+	banner := NewBanner(BanPolicy{Max4xx: 1, Window: time.Minute, BanDuration: time.Hour, ForgetAfter: time.Hour})
+	banner.now = func() time.Time { return now }
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	var prev time.Duration
+	for i := 0; i < 40; i++ {
+		banner.record(r, http.StatusNotFound)
+		banner.record(r, http.StatusNotFound)
+		left := banner.banLeft(r)
+		if left < prev {
+			t.Fatalf("ban %d: got %s, shorter than previous %s", i, left, prev)
+		}
+		prev = left
+		now = now.Add(left)
+	}
+}
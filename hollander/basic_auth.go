@@ -0,0 +1,110 @@
+package hollander
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"github.com/happywbfriends/nano/xerror"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	HTTP Basic по htpasswd-файлу с bcrypt-хешами (htpasswd -B), другие форматы хешей не принимаются.
+	Пользователя кладет в Values()[ValuePrincipal]. Файл перечитывается при изменении, см. NewAPIKeyAuthFile.
+
+	bcrypt медленный намеренно, поэтому успешные проверки кешируются до перечитывания файла.
+	Для неизвестного пользователя bcrypt тоже считается, чтобы время ответа не выдавало, есть ли такой пользователь.
+*/
+type BasicAuth struct {
+	realm string
+	file  *_ReloadableFile // *_Htpasswd
+}
+
+type _Htpasswd struct {
+	users    map[string][]byte
+	mu       sync.RWMutex
+	verified map[[sha256.Size]byte]struct{} // sha256(user:password) успешных проверок
+}
+
+// Хеш для неизвестных пользователей с bcrypt.DefaultCost, пароль к нему не важен
+var dummyBcrypt = []byte("$2a$10$jqKE7nHTp/wVjs41DAAIqOiZM93/dLYeGKR3WktpvyFZWyCAtLQye")
+
+func NewBasicAuthFile(realm, path string, reloadEvery time.Duration) (*BasicAuth, error) {
+	f, err := newReloadableFile(path, reloadEvery, func(data []byte) (interface{}, error) {
+		return parseHtpasswd(data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BasicAuth{realm: realm, file: f}, nil
+}
+
+func parseHtpasswd(data []byte) (*_Htpasswd, error) {
+	h := &_Htpasswd{users: make(map[string][]byte), verified: make(map[[sha256.Size]byte]struct{})}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		user, hash, found := strings.Cut(line, ":")
+		if !found || user == "" {
+			return nil, fmt.Errorf("line %d: expected 'user:hash'", n)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("line %d: user '%s': only bcrypt hashes are supported", n, user)
+		}
+		h.users[user] = []byte(hash)
+	}
+	return h, sc.Err()
+}
+
+// Перечитать htpasswd немедленно, например по SIGHUP
+func (a *BasicAuth) Reload() error {
+	return a.file.load()
+}
+
+func (a *BasicAuth) Handle(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+	challenge := fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", a.realm)
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false, authFailed(mw, challenge, "Authorization required")
+	}
+
+	h := a.file.get(mw.Log()).(*_Htpasswd)
+	if !h.verify(user, password) {
+		return false, authFailed(mw, challenge, "Invalid user or password")
+	}
+
+	mw.Values()[ValuePrincipal] = user
+	return true, nil
+}
+
+func (h *_Htpasswd) verify(user, password string) bool {
+	sum := sha256.Sum256([]byte(user + ":" + password))
+	h.mu.RLock()
+	_, cached := h.verified[sum]
+	h.mu.RUnlock()
+	if cached {
+		return true
+	}
+
+	hash, found := h.users[user]
+	if !found {
+		_ = bcrypt.CompareHashAndPassword(dummyBcrypt, []byte(password))
+		return false
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return false
+	}
+
+	h.mu.Lock()
+	h.verified[sum] = struct{}{}
+	h.mu.Unlock()
+	return true
+}
@@ -0,0 +1,301 @@
+package hollander
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	HeaderAcceptEncoding  = "Accept-Encoding"
+	HeaderContentEncoding = "Content-Encoding"
+	HeaderContentLength   = "Content-Length"
+	HeaderContentRange    = "Content-Range"
+	HeaderETag            = "ETag"
+
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+type Compression struct {
+	// Тела меньше не сжимаются, по умолчанию 1024. Ответ буферизуется, пока не наберется MinSize байт или не будет Flush
+	MinSize int
+	// Сжимаемые типы, можно маской type/*. По умолчанию DefaultCompressibleTypes
+	ContentTypes []string
+	// Уровень gzip/flate, 0 - flate.DefaultCompression
+	Level int
+}
+
+var DefaultCompressibleTypes = []string{
+	"text/*", ContentTypeJSON, ContentTypeProblemJSON, "application/javascript", "application/xml", "image/svg+xml",
+}
+
+/*
+	Сжатие ответов gzip или deflate по Accept-Encoding, см. Middleware.WithCompression.
+	Writer-ы переиспользуются через sync.Pool: gzip.Writer занимает сотни килобайт.
+*/
+type _Compressor struct {
+	minSize int
+	types   []string
+	gzip    sync.Pool
+	deflate sync.Pool
+}
+
+func newCompressor(cfg Compression) *_Compressor {
+	if cfg.MinSize == 0 {
+		cfg.MinSize = 1024
+	}
+	if cfg.ContentTypes == nil {
+		cfg.ContentTypes = DefaultCompressibleTypes
+	}
+	if cfg.Level == 0 {
+		cfg.Level = flate.DefaultCompression
+	}
+	if cfg.Level < flate.HuffmanOnly || cfg.Level > flate.BestCompression {
+		panic("invalid compression level")
+	}
+
+	c := &_Compressor{minSize: cfg.MinSize, types: cfg.ContentTypes}
+	c.gzip.New = func() interface{} {
+		w, _ := gzip.NewWriterLevel(nil, cfg.Level)
+		return w
+	}
+	c.deflate.New = func() interface{} {
+		w, _ := flate.NewWriter(nil, cfg.Level)
+		return w
+	}
+	return c
+}
+
+type _Encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+func (c *_Compressor) encoder(encoding string, w io.Writer) _Encoder {
+	var enc _Encoder
+	if encoding == EncodingGzip {
+		enc = c.gzip.Get().(*gzip.Writer)
+	} else {
+		enc = c.deflate.Get().(*flate.Writer)
+	}
+	enc.Reset(w)
+	return enc
+}
+
+func (c *_Compressor) release(encoding string, enc _Encoder) {
+	enc.Reset(nil)
+	if encoding == EncodingGzip {
+		c.gzip.Put(enc)
+	} else {
+		c.deflate.Put(enc)
+	}
+}
+
+func (c *_Compressor) compressible(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range c.types {
+		if mediaTypeMatches(pattern, mt) {
+			return true
+		}
+	}
+	return false
+}
+
+// Кодировка по Accept-Encoding: gzip предпочтительнее deflate при равном q. "" - клиент сжатие не принимает
+func acceptedEncoding(r *http.Request) string {
+	header := r.Header.Get(HeaderAcceptEncoding)
+	if header == "" {
+		return ""
+	}
+	ranges := parseAccept(header)
+	best, bestQ := "", 0.0
+	for _, enc := range []string{EncodingGzip, EncodingDeflate} {
+		q := -1.0
+		for _, mr := range ranges {
+			if mr.mediaType == enc {
+				q = mr.q
+				break
+			} else if mr.mediaType == "*" {
+				q = mr.q
+			}
+		}
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+/*
+	Стоит между _ResponseWriter и исходным writer. Заголовки не отправляются, пока не станет ясно, сжимать ли ответ:
+	до MinSize байт тела, Flush или конца обработки (close). Сжимается, только если клиент принимает сжатие,
+	тип подходит, хендлер сам не задал Content-Encoding и это не 206 или ответ без тела.
+	При сжатии Content-Length удаляется, а сильный ETag становится слабым: байты ответа уже другие.
+*/
+type _CompressWriter struct {
+	w        http.ResponseWriter
+	c        *_Compressor
+	encoding string // "" - не сжимать, только Vary
+	status   int
+	buf      []byte
+	decided  bool
+	hijacked bool
+	enc      _Encoder // nullable
+}
+
+func newCompressWriter(w http.ResponseWriter, c *_Compressor, r *http.Request) *_CompressWriter {
+	return &_CompressWriter{w: w, c: c, encoding: acceptedEncoding(r)}
+}
+
+func (cw *_CompressWriter) Header() http.Header {
+	return cw.w.Header()
+}
+
+func (cw *_CompressWriter) WriteHeader(code int) {
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		cw.w.WriteHeader(code)
+		return
+	}
+	if cw.status != 0 {
+		return
+	}
+	cw.status = code
+	if !bodyAllowed(code) {
+		cw.decide(false)
+	}
+}
+
+func bodyAllowed(code int) bool {
+	return code != http.StatusNoContent && code != http.StatusNotModified && code != http.StatusSwitchingProtocols
+}
+
+func (cw *_CompressWriter) Write(b []byte) (int, error) {
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(b)
+		}
+		return cw.w.Write(b)
+	}
+
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= cw.c.minSize {
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+/*
+	Решает, сжимать ли ответ, отправляет заголовки и накопленное тело.
+	big - тела достаточно для сжатия (набралось MinSize или идет стриминг)
+*/
+func (cw *_CompressWriter) decide(big bool) error {
+	cw.decided = true
+	h := cw.w.Header()
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if _, found := h[HeaderContentType]; !found && len(cw.buf) > 0 {
+		// то же сделал бы net/http, но позже, а тип нужен сейчас
+		h.Set(HeaderContentType, http.DetectContentType(cw.buf))
+	}
+
+	eligible := bodyAllowed(cw.status) && cw.status != http.StatusPartialContent && h.Get(HeaderContentRange) == "" &&
+		h.Get(HeaderContentEncoding) == "" && cw.c.compressible(h.Get(HeaderContentType))
+	if eligible {
+		// ответ зависит от Accept-Encoding, даже если этот клиент получит его несжатым
+		h.Add(HeaderVary, HeaderAcceptEncoding)
+	}
+	if eligible && big && cw.encoding != "" {
+		h.Del(HeaderContentLength)
+		h.Set(HeaderContentEncoding, cw.encoding)
+		if etag := h.Get(HeaderETag); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set(HeaderETag, "W/"+etag)
+		}
+		cw.enc = cw.c.encoder(cw.encoding, cw.w)
+	}
+
+	cw.w.WriteHeader(cw.status)
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(cw.buf)
+	} else {
+		_, err = cw.w.Write(cw.buf)
+	}
+	cw.buf = nil
+	return err
+}
+
+// Стриминг: размер ответа заранее неизвестен, поэтому подходящий тип сжимается и до MinSize
+func (cw *_CompressWriter) Flush() {
+	if !cw.decided {
+		_ = cw.decide(true)
+	}
+	if cw.enc != nil {
+		_ = cw.enc.Flush()
+	}
+	if f, ok := cw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Конец ответа: отправить то, что накопилось, и вернуть encoder в пул
+func (cw *_CompressWriter) close() error {
+	if cw.hijacked {
+		return nil
+	}
+	if !cw.decided {
+		// хендлер ничего не записал: пусть статус по умолчанию отправит net/http
+		if cw.status == 0 && len(cw.buf) == 0 {
+			return nil
+		}
+		if err := cw.decide(false); err != nil {
+			return err
+		}
+	}
+	if cw.enc == nil {
+		return nil
+	}
+	err := cw.enc.Close()
+	cw.c.release(cw.encoding, cw.enc)
+	cw.enc = nil
+	return err
+}
+
+func (cw *_CompressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := cw.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, buf, err := h.Hijack()
+	if err == nil {
+		cw.hijacked = true
+	}
+	return conn, buf, err
+}
+
+func (cw *_CompressWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := cw.w.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+func (cw *_CompressWriter) Unwrap() http.ResponseWriter {
+	return cw.w
+}
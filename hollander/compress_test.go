@@ -0,0 +1,149 @@
+package hollander
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"github.com/happywbfriends/nano/logger"
+	"github.com/happywbfriends/nano/xerror"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAcceptedEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                         "",
+		"gzip":                     EncodingGzip,
+		"deflate, gzip":            EncodingGzip,
+		"deflate, gzip;q=0.5":      EncodingDeflate,
+		"gzip;q=0, deflate;q=0.1":  EncodingDeflate,
+		"*":                        EncodingGzip,
+		"br, *;q=0.5, gzip;q=0":    EncodingDeflate,
+		"identity":                 "",
+		"GZIP":                     EncodingGzip,
+		"x-gzip, compress, br;q=1": "",
+	}
+	for header, want := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(HeaderAcceptEncoding, header)
+		if got := acceptedEncoding(r); got != want {
+			t.Errorf("%q: got %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestMiddleware_Compression(t *testing.T) {
+	big := strings.Repeat(`{"id":1,"name":"order"},`, 100)
+	mw := NewMiddleware(logger.NoLogger).WithCompression(Compression{MinSize: 512}).
+		Use(func(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+			q := r.URL.Query()
+			if etag := q.Get("etag"); etag != "" {
+				mw.SetHeader(HeaderETag, etag)
+			}
+			if enc := q.Get("encoded"); enc != "" {
+				mw.SetHeader(HeaderContentEncoding, enc)
+			}
+			switch q.Get("body") {
+			case "small":
+				mw.SendJSON(http.StatusOK, "small")
+			case "png":
+				mw.Send(http.StatusOK, "image/png", []byte(big))
+			case "none":
+				mw.Writer().WriteHeader(http.StatusNoContent)
+			default:
+				mw.Writer().Header().Set(HeaderContentLength, "2400")
+				mw.Send(http.StatusCreated, ContentTypeJSON, []byte(big))
+			}
+			return false, nil
+		})
+
+	serve := func(target, acceptEncoding string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		if acceptEncoding != "" {
+			r.Header.Set(HeaderAcceptEncoding, acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		mw.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(`/?etag="v1"`, "gzip")
+	h := w.Header()
+	if w.Code != http.StatusCreated || h.Get(HeaderContentEncoding) != EncodingGzip || h.Get(HeaderVary) != HeaderAcceptEncoding ||
+		h.Get(HeaderContentLength) != "" || h.Get(HeaderETag) != `W/"v1"` {
+		t.Fatalf("gzip: got status %d, headers %v", w.Code, h)
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); string(body) != big {
+		t.Errorf("gzip: got body %q", body)
+	}
+
+	w = serve("/", "deflate")
+	if body, _ := io.ReadAll(flate.NewReader(w.Body)); w.Header().Get(HeaderContentEncoding) != EncodingDeflate || string(body) != big {
+		t.Errorf("deflate: got headers %v, body %q", w.Header(), body)
+	}
+
+	// не сжимаются, но Vary нужен везде, где ответ мог бы быть сжат
+	tests := []struct {
+		name, target, acceptEncoding, vary string
+		status                             int
+	}{
+		{"no Accept-Encoding", "/", "", HeaderAcceptEncoding, http.StatusCreated},
+		{"small", "/?body=small", "gzip", HeaderAcceptEncoding, http.StatusOK},
+		{"content type", "/?body=png", "gzip", "", http.StatusOK},
+		{"already encoded", "/?encoded=br", "gzip", "", http.StatusCreated},
+		{"no content", "/?body=none", "gzip", "", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		w := serve(tt.target, tt.acceptEncoding)
+		h := w.Header()
+		if w.Code != tt.status || h.Get(HeaderVary) != tt.vary || (h.Get(HeaderContentEncoding) != "" && tt.name != "already encoded") {
+			t.Errorf("%s: got status %d, headers %v", tt.name, w.Code, h)
+		}
+	}
+	if w := serve("/", ""); w.Body.String() != big || w.Header().Get(HeaderContentLength) != "2400" {
+		t.Errorf("uncompressed: got headers %v, body %q", w.Header(), w.Body)
+	}
+}
+
+func TestMiddleware_CompressionStreaming(t *testing.T) {
+	var afterFlush []byte
+	w := httptest.NewRecorder()
+	mw := NewMiddleware(logger.NoLogger).WithCompression(Compression{}).
+		Use(func(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+			mw.SetHeader(HeaderContentType, "text/event-stream")
+			_, _ = io.WriteString(mw.Writer(), "data: 1\n\n")
+			mw.Writer().(http.Flusher).Flush()
+			afterFlush = append([]byte(nil), w.Body.Bytes()...)
+			_, _ = io.WriteString(mw.Writer(), "data: 2\n\n")
+			return false, nil
+		})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(HeaderAcceptEncoding, "gzip")
+	mw.ServeHTTP(w, r)
+
+	if !w.Flushed || w.Header().Get(HeaderContentEncoding) != EncodingGzip {
+		t.Fatalf("got headers %v, flushed %v", w.Header(), w.Flushed)
+	}
+	// первое событие дошло до клиента целиком, хотя меньше MinSize и поток еще не закрыт
+	zr, err := gzip.NewReader(bytes.NewReader(afterFlush))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 9)
+	if _, err := io.ReadFull(zr, buf); err != nil || string(buf) != "data: 1\n\n" {
+		t.Errorf("after flush: got %q, %v", buf, err)
+	}
+
+	zr, _ = gzip.NewReader(w.Body)
+	if body, _ := io.ReadAll(zr); string(body) != "data: 1\n\ndata: 2\n\n" {
+		t.Errorf("got body %q", body)
+	}
+}
@@ -0,0 +1,245 @@
+package hollander
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+/*
+	Дополнительное условие роута, кроме пути и метода. Позволяет обслуживать один и тот же путь
+	разными хендлерами в зависимости от хоста, версии API и т.п.:
+
+	router.HandleIf(Host("api.example.com"), http.MethodGet, "/orders", apiOrders)
+	router.HandleIf(Host("*.example.com"), http.MethodGet, "/orders", tenantOrders)
+	router.HandleIf(AcceptVersion("2"), http.MethodGet, "/orders", ordersV2)
+	router.Handle(http.MethodGet, "/orders", orders) // если ни одно условие не выполнилось
+
+	Условия проверяются в порядке регистрации, хендлер без условия - последним.
+	Если не выполнилось ни одно условие и хендлера без условия нет, отвечает NotFound
+	(или UnsupportedMediaType, если подошло все, кроме Consumes).
+*/
+type RouteCondition interface {
+	Match(r *http.Request) bool
+	String() string // для Routes()
+}
+
+// Хост без порта, без учета регистра. "*.example.com" - любой поддомен example.com (но не сам example.com)
+func Host(pattern string) RouteCondition {
+	return &_HostCondition{pattern: strings.ToLower(pattern)}
+}
+
+// Хотя бы одно из значений заголовка name совпадает с value
+func Header(name, value string) RouteCondition {
+	return &_HeaderCondition{name: http.CanonicalHeaderKey(name), value: value}
+}
+
+func AcceptVersion(version string) RouteCondition {
+	return Header(HeaderAcceptVersion, version)
+}
+
+// Произвольное условие, name используется только для описания в Routes()
+func Predicate(name string, f func(r *http.Request) bool) RouteCondition {
+	return &_PredicateCondition{name: name, f: f}
+}
+
+// Выполнены все условия
+func All(conds ...RouteCondition) RouteCondition {
+	if len(conds) == 1 {
+		return conds[0]
+	}
+	return _AllConditions(conds)
+}
+
+type _HostCondition struct {
+	pattern string
+}
+
+func (c *_HostCondition) Match(r *http.Request) bool {
+	host := stripPort(r.Host)
+	// EqualFold, а не ToLower, чтобы не аллоцировать
+	if strings.HasPrefix(c.pattern, "*.") {
+		suffix := c.pattern[1:] // .example.com
+		return len(host) > len(suffix) && strings.EqualFold(host[len(host)-len(suffix):], suffix)
+	}
+	return strings.EqualFold(host, c.pattern)
+}
+
+// host:port -> host, [::1]:port -> ::1. В отличие от net.SplitHostPort не аллоцирует ошибку, если порта нет
+func stripPort(host string) string {
+	i := strings.LastIndexByte(host, ':')
+	if i == -1 || strings.IndexByte(host[i:], ']') != -1 {
+		return strings.Trim(host, "[]")
+	}
+	return strings.Trim(host[:i], "[]")
+}
+
+func (c *_HostCondition) String() string {
+	return "host " + c.pattern
+}
+
+type _HeaderCondition struct {
+	name  string
+	value string
+}
+
+func (c *_HeaderCondition) Match(r *http.Request) bool {
+	for _, v := range r.Header[c.name] {
+		if v == c.value {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *_HeaderCondition) String() string {
+	return fmt.Sprintf("%s: %s", c.name, c.value)
+}
+
+type _PredicateCondition struct {
+	name string
+	f    func(r *http.Request) bool
+}
+
+func (c *_PredicateCondition) Match(r *http.Request) bool {
+	return c.f(r)
+}
+
+func (c *_PredicateCondition) String() string {
+	return c.name
+}
+
+type _AllConditions []RouteCondition
+
+func (c _AllConditions) Match(r *http.Request) bool {
+	for _, cond := range c {
+		if !cond.Match(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c _AllConditions) String() string {
+	s := make([]string, len(c))
+	for i, cond := range c {
+		s[i] = cond.String()
+	}
+	return strings.Join(s, " && ")
+}
+
+/*
+	Хендлер метода роута, у которого есть варианты с условиями.
+	Не меняется после публикации в таблице: HandleIf создает новый экземпляр (см. table.go).
+*/
+type _Conditional struct {
+	variants []_Variant
+	fallback http.Handler // без условия, nullable
+}
+
+type _Variant struct {
+	cond RouteCondition
+	h    http.Handler
+}
+
+func (c *_Conditional) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// serveRoute выбирает вариант сам, сюда попадем только при прямом вызове
+	h, unsupported := c.choose(r)
+	switch {
+	case h != nil:
+		h.ServeHTTP(w, r)
+	case unsupported:
+		defaultUnsupportedMediaTypeHandler.ServeHTTP(w, r)
+	default:
+		defaultNotFoundHandler.ServeHTTP(w, r)
+	}
+}
+
+/*
+	Первый вариант, условие которого выполнено, иначе fallback.
+	Если не подошло ничего, unsupported сообщает, был ли вариант, которому не подошел только Content-Type (тогда 415, а не 404).
+*/
+func (c *_Conditional) choose(r *http.Request) (h http.Handler, unsupported bool) {
+	for _, v := range c.variants {
+		if v.cond.Match(r) {
+			return v.h, false
+		}
+	}
+	if c.fallback != nil {
+		return c.fallback, false
+	}
+	for _, v := range c.variants {
+		if failsOnContentTypeOnly(v.cond, r) {
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+/*
+	Хендлер метода после регистрации h с условием cond (nil - без условия) поверх old.
+	existed - был ли уже хендлер с тем же условием, см. sameCondition.
+	old не меняется: он может быть в опубликованной таблице.
+*/
+func withCondition(old http.Handler, cond RouteCondition, h http.Handler) (merged http.Handler, existed bool) {
+	c, ok := old.(*_Conditional)
+	if !ok {
+		if cond == nil {
+			return h, old != nil
+		}
+		c = &_Conditional{fallback: old}
+	}
+
+	n := &_Conditional{fallback: c.fallback}
+	n.variants = append(n.variants, c.variants...)
+	if cond == nil {
+		existed = n.fallback != nil
+		n.fallback = h
+		return n, existed
+	}
+	for i := range n.variants {
+		if sameCondition(n.variants[i].cond, cond) {
+			n.variants[i].h = h
+			return n, true
+		}
+	}
+	n.variants = append(n.variants, _Variant{cond, h})
+	return n, false
+}
+
+/*
+	Встроенные условия, кроме Predicate, полностью задаются описанием, поэтому Host("a") дважды - одно и то же условие.
+	Функции не сравнить, так что Predicate и пользовательские условия равны, только если это один и тот же объект:
+	два Predicate с одним именем, но разными функциями - разные варианты роута.
+*/
+func sameCondition(a, b RouteCondition) bool {
+	switch a := a.(type) {
+	case _AllConditions:
+		b, ok := b.(_AllConditions)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !sameCondition(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case *_HostCondition, *_HeaderCondition, *_ConsumesCondition:
+		return reflect.TypeOf(a) == reflect.TypeOf(b) && a.String() == b.String()
+	}
+	// у несравнимых типов (срезы, функции) == паникует
+	return reflect.TypeOf(a).Comparable() && a == b
+}
+
+func (router *NanoRouter) HandleIf(cond RouteCondition, method, path string, h http.Handler) {
+	if cond == nil {
+		panic("condition is nil")
+	}
+	router.handle(cond, method, path, h, false)
+}
+
+func (router *NanoRouter) HandleFuncIf(cond RouteCondition, method, path string, h http.HandlerFunc) {
+	router.HandleIf(cond, method, path, &wrapFunc{h})
+}
@@ -0,0 +1,132 @@
+package hollander
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func replyText(text string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(text))
+	}
+}
+
+func TestHostAndHeaderRouting(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc(http.MethodGet, "/orders/:id", replyText("default"))
+	router.HandleFuncIf(Host("api.example.com"), http.MethodGet, "/orders/:id", replyText("api"))
+	router.HandleFuncIf(Host("*.example.com"), http.MethodGet, "/orders/:id", replyText("tenant"))
+	router.HandleFuncIf(AcceptVersion("2"), http.MethodGet, "/orders/:id", replyText("v2"))
+	router.HandleFuncIf(Predicate("beta", func(r *http.Request) bool { return r.URL.Query().Get("beta") == "1" }),
+		http.MethodGet, "/orders/:id", replyText("beta"))
+
+	// без хендлера по умолчанию
+	router.HandleFuncIf(Host("admin.local"), http.MethodGet, "/admin", replyText("admin"))
+
+	v3 := router.Group("/api").When(Host("*.example.com")).When(AcceptVersion("3"))
+	v3.HandleFunc(http.MethodGet, "/stocks", replyText("stocks v3"))
+
+	tests := []struct {
+		host         string
+		version      string
+		callUri      string
+		expectedCode int
+		expectedBody string
+	}{
+		{"example.org", "", "/orders/1", http.StatusOK, "default"},
+		{"api.example.com", "", "/orders/1", http.StatusOK, "api"},
+		{"API.Example.com:8080", "", "/orders/1", http.StatusOK, "api"},
+		{"shop.example.com", "", "/orders/1", http.StatusOK, "tenant"},
+		{"a.b.example.com", "", "/orders/1", http.StatusOK, "tenant"},
+		{"example.com", "", "/orders/1", http.StatusOK, "default"},
+		{"example.org", "2", "/orders/1", http.StatusOK, "v2"},
+		{"api.example.com", "2", "/orders/1", http.StatusOK, "api"}, // порядок регистрации
+		{"example.org", "", "/orders/1?beta=1", http.StatusOK, "beta"},
+		{"admin.local", "", "/admin", http.StatusOK, "admin"},
+		{"example.org", "", "/admin", http.StatusNotFound, ""},
+		{"shop.example.com", "3", "/api/stocks", http.StatusOK, "stocks v3"},
+		{"shop.example.com", "2", "/api/stocks", http.StatusNotFound, ""},
+		{"example.org", "3", "/api/stocks", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host+tt.callUri+" "+tt.version, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.callUri, nil)
+			r.Host = tt.host
+			if tt.version != "" {
+				r.Header.Set(HeaderAcceptVersion, tt.version)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != tt.expectedCode {
+				t.Fatalf("got status %d, want %d", w.Code, tt.expectedCode)
+			}
+			if tt.expectedBody != "" && w.Body.String() != tt.expectedBody {
+				t.Errorf("got body '%s', want '%s'", w.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestConditionalRouteHeadAndRoutes(t *testing.T) {
+	router := NewRouter()
+	router.HandleFuncIf(Host("a.local"), http.MethodGet, "/x", replyText("a"))
+	router.HandleFunc(http.MethodGet, "/x", replyText("default"))
+	router.HandleFuncIf(Host("a.local"), http.MethodGet, "/x", replyText("a2")) // тот же вариант - дубликат
+
+	r := httptest.NewRequest(http.MethodHead, "/x", nil)
+	r.Host = "a.local"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("HEAD: got status %d, body '%s'", w.Code, w.Body.String())
+	}
+
+	routes := router.Routes()
+	if len(routes) != 2 || routes[0].Condition != "host a.local" || routes[1].Condition != "" {
+		t.Fatalf("got routes %+v", routes)
+	}
+
+	if errs := router.Validate(); len(errs) != 1 {
+		t.Errorf("expected duplicate to be reported, got %v", errs)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/x", nil)
+	r.Host = "a.local"
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Body.String() != "a2" {
+		t.Errorf("got body '%s', want 'a2'", w.Body.String())
+	}
+}
+
+// Предикаты с одним именем, но разными функциями - разные варианты, а не дубликат
+func TestConditionalRoutePredicatesWithSameName(t *testing.T) {
+	byQuery := func(v string) func(r *http.Request) bool {
+		return func(r *http.Request) bool { return r.URL.Query().Get("v") == v }
+	}
+	router := NewRouter()
+	router.Strict = true
+	router.HandleFuncIf(Predicate("beta", byQuery("1")), http.MethodGet, "/x", replyText("beta1"))
+	router.HandleFuncIf(Predicate("beta", byQuery("2")), http.MethodGet, "/x", replyText("beta2"))
+
+	for uri, body := range map[string]string{"/x?v=1": "beta1", "/x?v=2": "beta2"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, uri, nil))
+		if w.Body.String() != body {
+			t.Errorf("%s: got %d '%s', want '%s'", uri, w.Code, w.Body.String(), body)
+		}
+	}
+	if routes := router.Routes(); len(routes) != 2 {
+		t.Errorf("got routes %+v", routes)
+	}
+
+	// а тот же самый предикат - дубликат
+	same := Predicate("gamma", byQuery("3"))
+	router = NewRouter()
+	router.HandleFuncIf(same, http.MethodGet, "/x", replyText("a"))
+	router.HandleFuncIf(same, http.MethodGet, "/x", replyText("b"))
+	if errs := router.Validate(); len(errs) != 1 {
+		t.Errorf("expected duplicate to be reported, got %v", errs)
+	}
+}
@@ -0,0 +1,67 @@
+package hollander
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+/*
+	Ограничение на значение path-параметра: /api/:id<int>, /items/:sku<[A-Z0-9]{8}>, /users/:uuid<uuid>
+	Проверяется при поиске роута: если значение не подходит, роутер пробует другие ветки, а затем NotFound.
+
+	Встроенные ограничения перечислены в builtinConstraints, все остальное считается регулярным выражением,
+	которое должно совпасть со значением сегмента целиком.
+*/
+type _Constraint struct {
+	source string // текст между < и >
+	match  func(value string) bool
+}
+
+var builtinConstraints = map[string]func(value string) bool{
+	"int":  isInt,
+	"uuid": isUUID,
+}
+
+func newConstraint(source string) (*_Constraint, error) {
+	if source == "" {
+		return nil, fmt.Errorf("empty constraint")
+	}
+
+	if f, ok := builtinConstraints[source]; ok {
+		return &_Constraint{source: source, match: f}, nil
+	}
+
+	re, err := regexp.Compile("^(?:" + source + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid constraint <%s>: %s", source, err)
+	}
+	return &_Constraint{source: source, match: re.MatchString}, nil
+}
+
+// То же, что принимает PathParamInt
+func isInt(value string) bool {
+	_, err := strconv.Atoi(value)
+	return err == nil
+}
+
+// xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
+func isUUID(value string) bool {
+	if len(value) != 36 {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
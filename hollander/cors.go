@@ -0,0 +1,264 @@
+package hollander
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderOrigin                        = "Origin"
+	HeaderVary                          = "Vary"
+	HeaderAccessControlRequestMethod    = "Access-Control-Request-Method"
+	HeaderAccessControlRequestHeaders   = "Access-Control-Request-Headers"
+	HeaderAccessControlAllowOrigin      = "Access-Control-Allow-Origin"
+	HeaderAccessControlAllowMethods     = "Access-Control-Allow-Methods"
+	HeaderAccessControlAllowHeaders     = "Access-Control-Allow-Headers"
+	HeaderAccessControlAllowCredentials = "Access-Control-Allow-Credentials"
+	HeaderAccessControlExposeHeaders    = "Access-Control-Expose-Headers"
+	HeaderAccessControlMaxAge           = "Access-Control-Max-Age"
+)
+
+type CORSConfig struct {
+	// "https://example.com" - точно, "https://*.example.com" - по маске, "*" - любой
+	AllowedOrigins []string
+	// Регулярные выражения, которым должен целиком соответствовать Origin
+	AllowedOriginPatterns []string
+	// Произвольная проверка, если Origin не подошел под AllowedOrigins и AllowedOriginPatterns
+	AllowOriginFunc func(origin string, r *http.Request) bool
+	// nil - методы роута (как в заголовке Allow)
+	AllowedMethods []string
+	// nil - только Accept, Accept-Language, Content-Language, Content-Type; "*" - любые
+	AllowedHeaders []string
+	// Заголовки ответа, доступные скрипту
+	ExposedHeaders []string
+	// Разрешить куки и Authorization. Несовместимо с "*" в AllowedOrigins: NewCORS паникует,
+	// т.к. это отдало бы credentials любому сайту
+	AllowCredentials bool
+	// Сколько браузер может кэшировать ответ на preflight, 0 - не указывать
+	MaxAge time.Duration
+}
+
+/*
+	CORS для NanoRouter и Middleware:
+
+	cors := NewCORS(CORSConfig{AllowedOrigins: []string{"https://*.example.com"}, AllowedHeaders: []string{"Authorization", "Content-Type"}})
+	router.CORS = cors                       // preflight (OPTIONS с Access-Control-Request-Method) для всех роутов
+	router.Group("/api").WithCORS(cors)      // заголовки в ответах на сами запросы
+
+	Preflight отвечается роутером до вызова хендлеров, в т.ч. явно зарегистрированных OPTIONS-хендлеров.
+	Если Origin, метод или заголовки не разрешены, ответ идет без CORS-заголовков, и браузер запрос не выполнит.
+*/
+type CORS struct {
+	anyOrigin     bool
+	origins       map[string]struct{} // в нижнем регистре
+	wildcards     [][2]string         // префикс и суффикс
+	patterns      []*regexp.Regexp
+	originFunc    func(origin string, r *http.Request) bool
+	methods       string // "", если в конфиге nil
+	anyHeader     bool
+	headers       map[string]struct{} // канонические имена
+	allowHeaders  string
+	exposeHeaders string
+	credentials   bool
+	maxAge        string
+}
+
+func NewCORS(cfg CORSConfig) *CORS {
+	c := &CORS{
+		origins:     make(map[string]struct{}),
+		originFunc:  cfg.AllowOriginFunc,
+		headers:     make(map[string]struct{}),
+		credentials: cfg.AllowCredentials,
+	}
+	for _, o := range cfg.AllowedOrigins {
+		o = strings.ToLower(o)
+		if o == "*" {
+			c.anyOrigin = true
+		} else if i := strings.IndexByte(o, '*'); i != -1 {
+			c.wildcards = append(c.wildcards, [2]string{o[:i], o[i+1:]})
+		} else {
+			c.origins[o] = struct{}{}
+		}
+	}
+	if c.anyOrigin && c.credentials {
+		panic("CORS: AllowCredentials cannot be used with '*' in AllowedOrigins")
+	}
+	for _, p := range cfg.AllowedOriginPatterns {
+		re, err := regexp.Compile("^(?:" + p + ")$")
+		if err != nil {
+			panic(fmt.Sprintf("invalid CORS origin pattern '%s': %s", p, err))
+		}
+		c.patterns = append(c.patterns, re)
+	}
+
+	methods := make([]string, len(cfg.AllowedMethods))
+	for i, m := range cfg.AllowedMethods {
+		methods[i] = strings.ToUpper(m)
+	}
+	c.methods = strings.Join(methods, ", ")
+
+	headers := cfg.AllowedHeaders
+	if headers == nil {
+		headers = []string{"Accept", "Accept-Language", "Content-Language", "Content-Type"}
+	}
+	var canonical []string
+	for _, h := range headers {
+		if h == "*" {
+			c.anyHeader = true
+			continue
+		}
+		h = http.CanonicalHeaderKey(h)
+		c.headers[h] = struct{}{}
+		canonical = append(canonical, h)
+	}
+	c.allowHeaders = strings.Join(canonical, ", ")
+
+	exposed := make([]string, len(cfg.ExposedHeaders))
+	for i, h := range cfg.ExposedHeaders {
+		exposed[i] = http.CanonicalHeaderKey(h)
+	}
+	c.exposeHeaders = strings.Join(exposed, ", ")
+
+	if cfg.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	}
+	return c
+}
+
+func (c *CORS) originAllowed(origin string, r *http.Request) bool {
+	if c.anyOrigin {
+		return true
+	}
+	lower := strings.ToLower(origin)
+	if _, ok := c.origins[lower]; ok {
+		return true
+	}
+	for _, w := range c.wildcards {
+		if len(lower) > len(w[0])+len(w[1]) && strings.HasPrefix(lower, w[0]) && strings.HasSuffix(lower, w[1]) {
+			return true
+		}
+	}
+	for _, re := range c.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return c.originFunc != nil && c.originFunc(origin, r)
+}
+
+// Ответ зависит от Origin, кэши должны это учитывать
+func (c *CORS) vary(h http.Header) {
+	if !c.anyOrigin {
+		h.Add(HeaderVary, HeaderOrigin)
+	}
+}
+
+// Origin разрешен и не пустой
+func (c *CORS) allowedOrigin(r *http.Request) (string, bool) {
+	origin := r.Header.Get(HeaderOrigin)
+	return origin, origin != "" && c.originAllowed(origin, r)
+}
+
+func (c *CORS) setOrigin(h http.Header, origin string) {
+	if c.anyOrigin {
+		h.Set(HeaderAccessControlAllowOrigin, "*")
+	} else {
+		h.Set(HeaderAccessControlAllowOrigin, origin)
+	}
+	if c.credentials {
+		h.Set(HeaderAccessControlAllowCredentials, "true")
+	}
+}
+
+// Заголовки для ответа на сам запрос (не preflight)
+func (c *CORS) decorate(h http.Header, r *http.Request) {
+	c.vary(h)
+	if origin, ok := c.allowedOrigin(r); ok {
+		c.setOrigin(h, origin)
+		if c.exposeHeaders != "" {
+			h.Set(HeaderAccessControlExposeHeaders, c.exposeHeaders)
+		}
+	}
+}
+
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get(HeaderAccessControlRequestMethod) != ""
+}
+
+// Ответ на preflight. routeMethods - методы роута через запятую, как в Allow
+func (c *CORS) preflight(w http.ResponseWriter, r *http.Request, routeMethods string) {
+	h := w.Header()
+	c.vary(h)
+	h.Add(HeaderVary, HeaderAccessControlRequestMethod)
+	h.Add(HeaderVary, HeaderAccessControlRequestHeaders)
+	h.Set(HeaderAllow, routeMethods)
+
+	methods := c.methods
+	if methods == "" {
+		methods = routeMethods
+	}
+	origin, originOk := c.allowedOrigin(r)
+	requestedHeaders, headersOk := c.headersAllowed(r)
+	if !originOk || !headersOk || !containsMethod(methods, r.Header.Get(HeaderAccessControlRequestMethod)) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	c.setOrigin(h, origin)
+	h.Set(HeaderAccessControlAllowMethods, methods)
+	if requestedHeaders != "" {
+		if c.anyHeader {
+			h.Set(HeaderAccessControlAllowHeaders, requestedHeaders)
+		} else {
+			h.Set(HeaderAccessControlAllowHeaders, c.allowHeaders)
+		}
+	}
+	if c.maxAge != "" {
+		h.Set(HeaderAccessControlMaxAge, c.maxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// methods - через ", "
+func containsMethod(methods, method string) bool {
+	for _, m := range strings.Split(methods, ", ") {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// Все запрошенные заголовки разрешены; requested - их список для ответа
+func (c *CORS) headersAllowed(r *http.Request) (requested string, ok bool) {
+	requested = strings.Join(r.Header.Values(HeaderAccessControlRequestHeaders), ",")
+	if c.anyHeader || requested == "" {
+		return requested, true
+	}
+	for _, h := range strings.Split(requested, ",") {
+		if h = strings.TrimSpace(h); h == "" {
+			continue
+		}
+		if _, found := c.headers[http.CanonicalHeaderKey(h)]; !found {
+			return requested, false
+		}
+	}
+	return requested, true
+}
+
+// CORS роутера или ближайшего роутера, в который он смонтирован
+func (router *NanoRouter) cors(up *_Mounted) *CORS {
+	if router.CORS != nil {
+		return router.CORS
+	}
+	for ; up != nil; up = up.up {
+		if up.router.CORS != nil {
+			return up.router.CORS
+		}
+	}
+	return nil
+}
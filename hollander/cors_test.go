@@ -0,0 +1,128 @@
+package hollander
+
+import (
+	"github.com/happywbfriends/nano/xerror"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCORS_Preflight(t *testing.T) {
+	cors := NewCORS(CORSConfig{
+		AllowedOrigins:        []string{"https://app.example.com", "https://*.example.org"},
+		AllowedOriginPatterns: []string{`https://partner-\d+\.com`},
+		AllowOriginFunc:       func(origin string, r *http.Request) bool { return origin == "https://trusted.net" },
+		AllowedHeaders:        []string{"Authorization", "content-type"},
+		AllowCredentials:      true,
+		MaxAge:                10 * time.Minute,
+	})
+
+	router := NewRouter()
+	router.CORS = cors
+	router.HandleFunc(http.MethodGet, "/orders/:id", replyText("order"))
+	router.HandleFunc(http.MethodPut, "/orders/:id", replyText("updated"))
+	sub := NewRouter()
+	sub.HandleFunc(http.MethodPost, "/invoices", replyText("invoice"))
+	router.Mount("/billing", sub)
+
+	tests := []struct {
+		name            string
+		uri             string
+		origin          string
+		method          string
+		headers         string
+		expectedOrigin  string
+		expectedMethods string
+		expectedHeaders string
+	}{
+		{"exact", "/orders/1", "https://app.example.com", "PUT", "authorization", "https://app.example.com", "GET, HEAD, OPTIONS, PUT", "Authorization, Content-Type"},
+		{"wildcard", "/orders/1", "https://shop.example.org", "GET", "", "https://shop.example.org", "GET, HEAD, OPTIONS, PUT", ""},
+		{"wildcard apex", "/orders/1", "https://.example.org", "GET", "", "", "", ""},
+		{"regex", "/orders/1", "https://partner-42.com", "GET", "", "https://partner-42.com", "GET, HEAD, OPTIONS, PUT", ""},
+		{"func", "/orders/1", "https://trusted.net", "GET", "", "https://trusted.net", "GET, HEAD, OPTIONS, PUT", ""},
+		{"unknown origin", "/orders/1", "https://evil.com", "GET", "", "", "", ""},
+		{"method not allowed", "/orders/1", "https://app.example.com", "DELETE", "", "", "", ""},
+		{"header not allowed", "/orders/1", "https://app.example.com", "PUT", "X-Secret", "", "", ""},
+		{"mounted", "/billing/invoices", "https://app.example.com", "POST", "", "https://app.example.com", "OPTIONS, POST", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodOptions, tt.uri, nil)
+			r.Header.Set(HeaderOrigin, tt.origin)
+			r.Header.Set(HeaderAccessControlRequestMethod, tt.method)
+			if tt.headers != "" {
+				r.Header.Set(HeaderAccessControlRequestHeaders, tt.headers)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			h := w.Header()
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("got status %d", w.Code)
+			}
+			if h.Get(HeaderAccessControlAllowOrigin) != tt.expectedOrigin ||
+				h.Get(HeaderAccessControlAllowMethods) != tt.expectedMethods ||
+				h.Get(HeaderAccessControlAllowHeaders) != tt.expectedHeaders {
+				t.Errorf("got headers %v", h)
+			}
+			if tt.expectedOrigin != "" && (h.Get(HeaderAccessControlAllowCredentials) != "true" || h.Get(HeaderAccessControlMaxAge) != "600") {
+				t.Errorf("got headers %v", h)
+			}
+			if !strings.Contains(strings.Join(h.Values(HeaderVary), ","), HeaderOrigin) {
+				t.Errorf("no Vary: Origin in %v", h)
+			}
+		})
+	}
+
+	// обычный OPTIONS без CORS по-прежнему отвечает Allow
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/orders/1", nil))
+	if w.Code != http.StatusNoContent || w.Header().Get(HeaderAllow) != "GET, HEAD, OPTIONS, PUT" || w.Header().Get(HeaderAccessControlAllowOrigin) != "" {
+		t.Errorf("plain OPTIONS: got status %d, headers %v", w.Code, w.Header())
+	}
+}
+
+func TestCORS_Middleware(t *testing.T) {
+	cors := NewCORS(CORSConfig{AllowedOrigins: []string{"*"}, ExposedHeaders: []string{"x-request-id"}})
+
+	router := NewRouter()
+	router.CORS = cors
+	router.Group("").WithCORS(cors).Serve(http.MethodGet, "/orders", func(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+		if r.URL.Query().Get("fail") != "" {
+			return false, xerror.NewBadRequest("bad")
+		}
+		mw.SendText(http.StatusOK, "orders")
+		return false, nil
+	})
+
+	for _, uri := range []string{"/orders", "/orders?fail=1"} {
+		r := httptest.NewRequest(http.MethodGet, uri, nil)
+		r.Header.Set(HeaderOrigin, "https://anyone.com")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Header().Get(HeaderAccessControlAllowOrigin) != "*" || w.Header().Get(HeaderAccessControlExposeHeaders) != "X-Request-Id" {
+			t.Errorf("%s: got headers %v", uri, w.Header())
+		}
+		if w.Header().Get(HeaderVary) != "" {
+			t.Errorf("%s: Vary is not needed for '*' without credentials", uri)
+		}
+	}
+
+	// без Origin - без CORS-заголовков
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	if w.Header().Get(HeaderAccessControlAllowOrigin) != "" {
+		t.Errorf("got headers %v", w.Header())
+	}
+}
+
+func TestNewCORS_AnyOriginWithCredentials(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for '*' with AllowCredentials")
+		}
+	}()
+	NewCORS(CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+}
@@ -0,0 +1,67 @@
+package hollander
+
+import (
+	"encoding/json"
+	"github.com/happywbfriends/nano/xerror"
+	"net/http"
+)
+
+/*
+	Отправляет клиенту ошибку, которую вернул HttpHandler (или 500 после паники).
+	К моменту вызова заголовки ответа еще не отправлены, status уже вычислен из e.HttpStatus() (0 -> 500).
+	Задается через Middleware.WithErrorRenderer, по умолчанию TextErrorRenderer.
+*/
+type ErrorRenderer func(r *http.Request, mw IMiddleware, status int, e xerror.IError)
+
+// text/plain с PublicMessage, без тела, если сообщения нет
+func TextErrorRenderer(r *http.Request, mw IMiddleware, status int, e xerror.IError) {
+	if publicMessage := e.PublicMessage(); publicMessage != "" {
+		mw.SendText(status, publicMessage)
+	} else {
+		mw.Send(status, "", nil)
+	}
+}
+
+// Тело ответа application/problem+json, RFC 7807
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	RequestId string `json:"request_id,omitempty"`
+	Code      int    `json:"code,omitempty"` // код ошибки приложения, xerror.IError.JsonRpcErrorCode()
+}
+
+func NewProblem(mw IMiddleware, status int, e xerror.IError) Problem {
+	return Problem{
+		Type:      "about:blank", // тип ошибки определяется статусом
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    e.PublicMessage(),
+		RequestId: mw.RequestId(),
+		Code:      e.JsonRpcErrorCode(),
+	}
+}
+
+func ProblemJSONErrorRenderer(r *http.Request, mw IMiddleware, status int, e xerror.IError) {
+	d, err := json.Marshal(NewProblem(mw, status, e))
+	if err != nil {
+		// в Problem нет полей, которые могут не сериализоваться, но на всякий случай
+		TextErrorRenderer(r, mw, status, e)
+		return
+	}
+	mw.Send(status, ContentTypeProblemJSON, d)
+}
+
+/*
+	problem+json, если клиент предпочитает JSON (Accept: application/json или application/problem+json), иначе текст.
+	Без Accept - текст, как и раньше. Ошибку нельзя не отдать, поэтому 406 здесь не бывает.
+*/
+func NegotiatedErrorRenderer(r *http.Request, mw IMiddleware, status int, e xerror.IError) {
+	ct, xe := Negotiate(r, ContentTypeText, ContentTypeProblemJSON, ContentTypeJSON)
+	if xe == nil && ct != ContentTypeText {
+		ProblemJSONErrorRenderer(r, mw, status, e)
+		return
+	}
+	TextErrorRenderer(r, mw, status, e)
+}
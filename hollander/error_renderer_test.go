@@ -0,0 +1,66 @@
+package hollander
+
+import (
+	"encoding/json"
+	"github.com/happywbfriends/nano/logger"
+	"github.com/happywbfriends/nano/xerror"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorRenderers(t *testing.T) {
+	failing := func(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+		if r.URL.Query().Get("panic") != "" {
+			panic("boom")
+		}
+		return false, xerror.NewCustom(http.StatusConflict, 1042, "order is locked")
+	}
+
+	tests := []struct {
+		name                string
+		render              ErrorRenderer
+		accept              string
+		uri                 string
+		expectedContentType string
+		expectedBody        string
+	}{
+		{"default", nil, "", "/", ContentTypeText, "order is locked"},
+		{"problem", ProblemJSONErrorRenderer, "", "/",
+			ContentTypeProblemJSON, `{"type":"about:blank","title":"Conflict","status":409,"detail":"order is locked","request_id":"req","code":1042}`},
+		{"panic", ProblemJSONErrorRenderer, "", "/?panic=1",
+			ContentTypeProblemJSON, `{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"Internal Server Error","request_id":"req","code":-32603}`},
+		{"negotiated text", NegotiatedErrorRenderer, "", "/", ContentTypeText, "order is locked"},
+		{"negotiated json", NegotiatedErrorRenderer, "application/json", "/", ContentTypeProblemJSON, ""},
+		{"negotiated problem", NegotiatedErrorRenderer, "text/plain;q=0.5, application/problem+json", "/", ContentTypeProblemJSON, ""},
+		{"negotiated html", NegotiatedErrorRenderer, "text/html", "/", ContentTypeText, "order is locked"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := NewMiddleware(logger.NoLogger).Use(failing)
+			if tt.render != nil {
+				mw.WithErrorRenderer(tt.render)
+			}
+			r := httptest.NewRequest(http.MethodGet, tt.uri, nil)
+			r.Header.Set(HeaderRequestId, "req")
+			if tt.accept != "" {
+				r.Header.Set(HeaderAccept, tt.accept)
+			}
+			w := httptest.NewRecorder()
+			mw.ServeHTTP(w, r)
+
+			if ct := w.Header().Get(HeaderContentType); ct != tt.expectedContentType {
+				t.Errorf("got content type '%s', want '%s'", ct, tt.expectedContentType)
+			}
+			if tt.expectedBody != "" && w.Body.String() != tt.expectedBody {
+				t.Errorf("got body '%s', want '%s'", w.Body.String(), tt.expectedBody)
+			}
+			if tt.expectedContentType == ContentTypeProblemJSON {
+				var p Problem
+				if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil || p.Status != w.Code {
+					t.Errorf("got problem %+v (%v) with status %d", p, err, w.Code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package hollander
+
+import (
+	"github.com/happywbfriends/nano/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/*
+	Группа роутов с общим префиксом пути и общими настройками Middleware.
+
+	api := router.Group("/api/v1").WithLog(log).WithMetrics("orders").WithTimeoutContext(time.Second).Use(auth)
+	api.Serve(http.MethodGet, "/orders/:id", getOrder)
+
+	admin := api.Group("/admin").Use(adminOnly) // наследует префикс и все настройки api
+	admin.Serve(http.MethodPost, "/reload", reload).WithTimeoutContext(time.Minute) // переопределение для одного роута
+
+	Настройки группы копируются в Middleware в момент регистрации роута (и во вложенную группу в момент ее создания),
+	поэтому их надо задавать до регистрации роутов.
+*/
+type RouteGroup struct {
+	router    *NanoRouter
+	prefix    string     // без слэша в конце, "" для корня
+	proto     Middleware // прототип, копия которого достается каждому роуту группы
+	metricsNs string     // если не пустой, каждый роут получает метрики с этим namespace
+	conds     []RouteCondition
+}
+
+func (router *NanoRouter) Group(prefix string) *RouteGroup {
+	return &RouteGroup{
+		router: router,
+		prefix: normalizePrefix(prefix),
+		proto:  Middleware{log: logger.NoLogger},
+	}
+}
+
+func (g *RouteGroup) Group(prefix string) *RouteGroup {
+	return &RouteGroup{
+		router:    g.router,
+		prefix:    g.prefix + normalizePrefix(prefix),
+		proto:     g.proto.clone(),
+		metricsNs: g.metricsNs,
+		conds:     append([]RouteCondition(nil), g.conds...),
+	}
+}
+
+func (g *RouteGroup) Prefix() string {
+	return g.prefix
+}
+
+func (g *RouteGroup) WithLog(log logger.ILogger) *RouteGroup {
+	g.proto.log = log
+	return g
+}
+
+func (g *RouteGroup) Set(k string, v interface{}) *RouteGroup {
+	g.proto.Set(k, v)
+	return g
+}
+
+func (g *RouteGroup) Use(h HttpHandler) *RouteGroup {
+	g.proto.Use(h)
+	return g
+}
+
+// Метрики каждого роута регистрируются с лейблом method = "<METHOD> <полный шаблон пути>"
+func (g *RouteGroup) WithMetrics(ns string) *RouteGroup {
+	g.metricsNs = ns
+	return g
+}
+
+func (g *RouteGroup) WithTimeoutContext(timeout time.Duration) *RouteGroup {
+	g.proto.WithTimeoutContext(timeout)
+	return g
+}
+
+// Счетчик сэмплирования общий для всех роутов группы
+func (g *RouteGroup) WithAccessLog(cfg AccessLog) *RouteGroup {
+	g.proto.WithAccessLog(cfg)
+	return g
+}
+
+func (g *RouteGroup) WithErrorRenderer(render ErrorRenderer) *RouteGroup {
+	g.proto.WithErrorRenderer(render)
+	return g
+}
+
+func (g *RouteGroup) WithBanner(b *Banner) *RouteGroup {
+	g.proto.WithBanner(b)
+	return g
+}
+
+func (g *RouteGroup) WithCORS(c *CORS) *RouteGroup {
+	g.proto.WithCORS(c)
+	return g
+}
+
+func (g *RouteGroup) WithCompression(cfg Compression) *RouteGroup {
+	g.proto.WithCompression(cfg)
+	return g
+}
+
+func (g *RouteGroup) WithPanicHandler(h PanicHandler) *RouteGroup {
+	g.proto.WithPanicHandler(h)
+	return g
+}
+
+func (g *RouteGroup) WithMaxBytesReader(maxBytes int64) *RouteGroup {
+	g.proto.WithMaxBytesReader(maxBytes)
+	return g
+}
+
+/*
+	Роуты группы регистрируются с условием (см. HandleIf), при нескольких вызовах должны выполниться все условия.
+	Удобно для виртуальных хостов и версий API:
+
+	v2 := router.Group("/api").When(AcceptVersion("2"))
+	tenants := router.Group("").When(Host("*.example.com"))
+
+	На Mount условия не распространяются.
+*/
+func (g *RouteGroup) When(cond RouteCondition) *RouteGroup {
+	g.conds = append(g.conds, cond)
+	return g
+}
+
+// Регистрирует обычный http.Handler с префиксом группы, без Middleware
+func (g *RouteGroup) Handle(method, path string, h http.Handler) {
+	g.router.handle(g.cond(), method, g.prefix+path, h, false)
+}
+
+func (g *RouteGroup) HandleFunc(method, path string, h http.HandlerFunc) {
+	g.Handle(method, path, &wrapFunc{h})
+}
+
+/*
+	Регистрирует роут, обслуживаемый Middleware с настройками группы: сперва выполняются HttpHandler-ы группы, затем handlers.
+	Возвращает этот Middleware, чтобы можно было переопределить настройки для конкретного роута.
+*/
+func (g *RouteGroup) Serve(method, path string, handlers ...HttpHandler) *Middleware {
+	fullPath := g.prefix + path
+
+	mw := g.proto.clone()
+	var registered []prometheus.Collector
+	if g.metricsNs != "" {
+		mw.metrics, registered = reuseHttpMetrics(g.metricsNs, method+" "+fullPath)
+		mw.metricsEnabled = true
+	}
+	for _, h := range handlers {
+		mw.Use(h)
+	}
+
+	// метрики регистрируются до публикации mw в таблице роутов, поэтому при панике (Strict) их надо убрать
+	defer func() {
+		if e := recover(); e != nil {
+			for _, c := range registered {
+				prometheus.Unregister(c)
+			}
+			panic(e)
+		}
+	}()
+	g.router.handle(g.cond(), method, fullPath, &mw, false)
+	return &mw
+}
+
+func (g *RouteGroup) cond() RouteCondition {
+	if len(g.conds) == 0 {
+		return nil
+	}
+	return All(g.conds...)
+}
+
+// "/api/" -> "/api", "api" -> "/api", "/" -> ""
+func normalizePrefix(prefix string) string {
+	prefix = strings.TrimRight(prefix, "/")
+	if prefix != "" && prefix[0] != '/' {
+		prefix = "/" + prefix
+	}
+	return prefix
+}
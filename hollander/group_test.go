@@ -0,0 +1,114 @@
+package hollander
+
+import (
+	"github.com/happywbfriends/nano/xerror"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRouteGroup(t *testing.T) {
+	router := NewRouter()
+
+	var trace []string
+	tracer := func(name string) HttpHandler {
+		return func(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+			trace = append(trace, name)
+			return true, nil
+		}
+	}
+	reply := func(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+		deadline := "-"
+		if _, ok := mw.Context().Deadline(); ok {
+			deadline = "deadline"
+		}
+		mw.SendText(http.StatusOK, mw.PathParam("id")+" "+mw.Values()["scope"].(string)+" "+deadline)
+		return false, nil
+	}
+
+	api := router.Group("/api/v1/").Set("scope", "api").Use(tracer("api"))
+	api.Serve(http.MethodGet, "/orders/:id", tracer("route"), reply)
+
+	admin := api.Group("admin").Set("scope", "admin").Use(tracer("admin")).WithTimeoutContext(time.Second)
+	admin.Serve(http.MethodGet, "/users/:id", reply)
+	admin.Serve(http.MethodGet, "/slow/:id", reply).WithTimeoutContext(0)
+
+	// настройки вложенной группы не должны затрагивать родителя
+	api.Serve(http.MethodGet, "/stocks/:id", reply)
+
+	tests := []struct {
+		callUri       string
+		expectedBody  string
+		expectedTrace string
+	}{
+		{"/api/v1/orders/1", "1 api -", "api,route"},
+		{"/api/v1/admin/users/2", "2 admin deadline", "api,admin"},
+		{"/api/v1/admin/slow/3", "3 admin -", "api,admin"},
+		{"/api/v1/stocks/4", "4 api -", "api"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.callUri, func(t *testing.T) {
+			trace = nil
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.callUri, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d", w.Code)
+			}
+			if w.Body.String() != tt.expectedBody {
+				t.Errorf("got body '%s', want '%s'", w.Body.String(), tt.expectedBody)
+			}
+			if got := strings.Join(trace, ","); got != tt.expectedTrace {
+				t.Errorf("got trace '%s', want '%s'", got, tt.expectedTrace)
+			}
+		})
+	}
+}
+
+func TestNormalizePrefix(t *testing.T) {
+	for prefix, expected := range map[string]string{"": "", "/": "", "/api/": "/api", "api": "/api", "/a/b": "/a/b"} {
+		if got := normalizePrefix(prefix); got != expected {
+			t.Errorf("normalizePrefix(%s) = '%s', want '%s'", prefix, got, expected)
+		}
+	}
+}
+
+func TestRouteGroup_MetricsReRegistration(t *testing.T) {
+	ok := func(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+		mw.SendText(http.StatusOK, "ok")
+		return false, nil
+	}
+
+	// повторная регистрация роута переиспользует его метрики, а не паникует на дубликате коллектора
+	router := NewRouter()
+	g := router.Group("/m").WithMetrics("test_group_rereg")
+	g.Serve(http.MethodGet, "/x", ok)
+	mw := g.Serve(http.MethodGet, "/x", ok)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/m/x", nil))
+	if n := testutil.ToFloat64(mw.metrics.NbReq); n != 1 {
+		t.Errorf("got %v requests in metrics, want 1", n)
+	}
+
+	// роут, отклоненный Strict, не оставляет зарегистрированных метрик
+	strict := NewRouter()
+	strict.Strict = true
+	sg := strict.Group("/s").WithMetrics("test_group_strict")
+	sg.Serve(http.MethodGet, "/orders/:id", ok)
+	sg.Serve(http.MethodDelete, "/orders/:id", ok)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected Strict panic")
+			}
+		}()
+		sg.Serve(http.MethodGet, "/orders/new", ok) // перекрывает DELETE /orders/:id
+	}()
+	c := makeCounter("test_group_strict", "http_nb_req", "GET /s/orders/new")
+	if err := prometheus.Register(c); err != nil {
+		t.Errorf("metrics of rejected route are still registered: %s", err)
+	}
+	prometheus.Unregister(c)
+}
@@ -11,6 +11,9 @@ type HTTPMetrics struct {
 	NbReq5xx         prometheus.Counter
 	Latency2xxMillis prometheus.Summary
 	NbCurrentConns   prometheus.Gauge
+	NbPanics         prometheus.Counter
+	NbRateLimited    prometheus.Counter
+	NbAuthFailed     prometheus.Counter
 }
 
 // https://youtrack.wildberries.ru/articles/SAPI-A-60/Metriki
@@ -22,5 +25,30 @@ func NewHttpMetrics(ns, methodName string) HTTPMetrics {
 		NbReq5xx:         newCounter(ns, "http_nb_req_5xx", methodName),
 		Latency2xxMillis: newSummary(ns, "http_latency_2xx_ms", methodName),
 		NbCurrentConns:   newGauge(ns, "http_nb_current_conns", methodName),
+		NbPanics:         newCounter(ns, "http_nb_panics", methodName),
+		NbRateLimited:    newCounter(ns, "http_nb_rate_limited", methodName),
+		NbAuthFailed:     newCounter(ns, "http_nb_auth_failed", methodName),
 	}
 }
+
+/*
+	Метрики роута группы. Метрики, уже зарегистрированные с тем же namespace и method (например, у роута,
+	который сейчас заменяется), переиспользуются, а не вызывают панику.
+	registered - созданные заново, их регистрацию надо отменить, если роут так и не был зарегистрирован.
+*/
+func reuseHttpMetrics(ns, methodName string) (m HTTPMetrics, registered []prometheus.Collector) {
+	counter := func(name string) prometheus.Counter {
+		return registerOrReuse(makeCounter(ns, name, methodName), &registered).(prometheus.Counter)
+	}
+	return HTTPMetrics{
+		NbReq:            counter("http_nb_req"),
+		NbReq2xx:         counter("http_nb_req_2xx"),
+		NbReq4xx:         counter("http_nb_req_4xx"),
+		NbReq5xx:         counter("http_nb_req_5xx"),
+		Latency2xxMillis: registerOrReuse(makeSummary(ns, "http_latency_2xx_ms", methodName), &registered).(prometheus.Summary),
+		NbCurrentConns:   registerOrReuse(makeGauge(ns, "http_nb_current_conns", methodName), &registered).(prometheus.Gauge),
+		NbPanics:         counter("http_nb_panics"),
+		NbRateLimited:    counter("http_nb_rate_limited"),
+		NbAuthFailed:     counter("http_nb_auth_failed"),
+	}, registered
+}
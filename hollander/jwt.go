@@ -0,0 +1,419 @@
+package hollander
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/happywbfriends/nano/xerror"
+	"math"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	JWTAlgHS256 = "HS256"
+	JWTAlgRS256 = "RS256"
+	JWTAlgES256 = "ES256"
+
+	HeaderAuthorization   = "Authorization"
+	HeaderWWWAuthenticate = "WWW-Authenticate"
+
+	// Ключ в IMiddleware.Values() со всеми claims токена, JWTClaims
+	ValueJWTClaims = "jwt.claims"
+
+	DefaultJWTClaimsPrefix = "jwt."
+)
+
+// Ключ проверки подписи
+type JWTKey struct {
+	ID  string // kid, может быть пустым
+	Alg string
+	key interface{} // []byte, *rsa.PublicKey или *ecdsa.PublicKey
+}
+
+type JWTClaims map[string]interface{}
+
+type JWTConfig struct {
+	Keys      []JWTKey
+	Issuer    string        // если задан, iss должен совпадать
+	Audience  []string      // если задан, aud должен содержать хотя бы одно из значений
+	ClockSkew time.Duration // допуск при проверке exp и nbf
+	Realm     string        // для WWW-Authenticate
+	// Claims кладутся в Values() с этим префиксом: строки - как есть, целые числа - int, прочее - как распарсил encoding/json.
+	// Так их можно получить тегом Vat `context:"jwt.sub"`. По умолчанию DefaultJWTClaimsPrefix: без префикса
+	// клиент своими claims подменил бы значения, заданные через Middleware.Set
+	ClaimsPrefix string
+}
+
+/*
+	Проверка JWT из заголовка Authorization: Bearer, HttpHandler для Middleware:
+
+	keys, err := LoadJWKSFile("/etc/app/jwks.json")
+	auth := NewJWTAuth(JWTConfig{Keys: keys, Issuer: "https://auth.example.com", Audience: []string{"orders"}})
+	router.Group("/api").Use(auth.Handle)
+
+	Алгоритм берется из ключа, а не из токена: токен с другим alg (в т.ч. "none") отклоняется.
+	Без токена или с неверным токеном - 401 с WWW-Authenticate по RFC 6750.
+*/
+type JWTAuth struct {
+	cfg JWTConfig
+}
+
+func NewJWTAuth(cfg JWTConfig) *JWTAuth {
+	if len(cfg.Keys) == 0 {
+		panic("no JWT keys")
+	}
+	if cfg.ClaimsPrefix == "" {
+		cfg.ClaimsPrefix = DefaultJWTClaimsPrefix
+	}
+	return &JWTAuth{cfg: cfg}
+}
+
+func (a *JWTAuth) Handle(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+	token, found := bearerToken(r)
+	if !found {
+		return false, authFailed(mw, fmt.Sprintf("Bearer realm=%q", a.cfg.Realm), "Bearer token required")
+	}
+
+	claims, err := a.Verify(token, time.Now())
+	if err != nil {
+		challenge := fmt.Sprintf("Bearer realm=%q, error=\"invalid_token\", error_description=%q", a.cfg.Realm, err.Error())
+		return false, authFailed(mw, challenge, "Invalid token: "+err.Error())
+	}
+
+	vals := mw.Values()
+	for k, v := range claims {
+		if f, ok := v.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			v = int(f)
+		}
+		vals[a.cfg.ClaimsPrefix+k] = v
+	}
+	// после claims: одноименные claims не должны их подменять
+	vals[ValueJWTClaims] = claims
+	if sub, ok := claims["sub"].(string); ok {
+		vals[ValuePrincipal] = sub
+	}
+	// scope по RFC 8693 - строка через пробел
+	if scope, ok := claims["scope"].(string); ok {
+		vals[ValueScopes] = strings.Fields(scope)
+	}
+	return true, nil
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	auth := r.Header.Get(HeaderAuthorization)
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(auth[7:])
+	return token, token != ""
+}
+
+type _JWTHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Проверяет подпись и claims, now - текущее время
+func (a *JWTAuth) Verify(token string, now time.Time) (JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header _JWTHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed header: %s", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed signature")
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	if !a.verifySignature(header, signed, sig) {
+		return nil, errors.New("invalid signature")
+	}
+
+	var claims JWTClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed claims: %s", err)
+	}
+	if err := a.checkClaims(claims, now); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func decodeJWTPart(part string, dest interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dest)
+}
+
+func (a *JWTAuth) verifySignature(header _JWTHeader, signed, sig []byte) bool {
+	digest := sha256.Sum256(signed)
+	for _, k := range a.cfg.Keys {
+		if k.Alg != header.Alg || (header.Kid != "" && k.ID != "" && k.ID != header.Kid) {
+			continue
+		}
+		switch key := k.key.(type) {
+		case []byte:
+			mac := hmac.New(sha256.New, key)
+			mac.Write(signed)
+			if hmac.Equal(mac.Sum(nil), sig) {
+				return true
+			}
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil {
+				return true
+			}
+		case *ecdsa.PublicKey:
+			// ES256: r и s по 32 байта подряд, не ASN.1
+			if len(sig) == 64 {
+				r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+				if ecdsa.Verify(key, digest[:], r, s) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (a *JWTAuth) checkClaims(claims JWTClaims, now time.Time) error {
+	skew := a.cfg.ClockSkew
+	if exp, found, err := numericDate(claims, "exp"); err != nil {
+		return err
+	} else if found && !now.Before(exp.Add(skew)) {
+		return errors.New("token is expired")
+	}
+	if nbf, found, err := numericDate(claims, "nbf"); err != nil {
+		return err
+	} else if found && now.Add(skew).Before(nbf) {
+		return errors.New("token is not valid yet")
+	}
+
+	if a.cfg.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != a.cfg.Issuer {
+			return errors.New("invalid issuer")
+		}
+	}
+
+	if len(a.cfg.Audience) > 0 {
+		var aud []string
+		switch v := claims["aud"].(type) {
+		case string:
+			aud = []string{v}
+		case []interface{}:
+			for _, s := range v {
+				if str, ok := s.(string); ok {
+					aud = append(aud, str)
+				}
+			}
+		}
+		if !intersects(aud, a.cfg.Audience) {
+			return errors.New("invalid audience")
+		}
+	}
+	return nil
+}
+
+func numericDate(claims JWTClaims, name string) (t time.Time, found bool, err error) {
+	v, found := claims[name]
+	if !found {
+		return t, false, nil
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return t, false, fmt.Errorf("invalid '%s' claim", name)
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)), true, nil
+}
+
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+	Ключ из файла: для HS256 - сам секрет (пробельные символы по краям отбрасываются),
+	для RS256 и ES256 - PEM с открытым ключом (PUBLIC KEY, RSA PUBLIC KEY) или сертификатом.
+*/
+func LoadJWTKeyFile(alg, kid, path string) (JWTKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return JWTKey{}, err
+	}
+	return ParseJWTKey(alg, kid, data)
+}
+
+func ParseJWTKey(alg, kid string, data []byte) (JWTKey, error) {
+	k := JWTKey{ID: kid, Alg: alg}
+	if alg == JWTAlgHS256 {
+		secret := []byte(strings.TrimSpace(string(data)))
+		if len(secret) == 0 {
+			return k, errors.New("empty HS256 secret")
+		}
+		k.key = secret
+		return k, nil
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return k, errors.New("no PEM block found")
+	}
+	var pub interface{}
+	var err error
+	switch block.Type {
+	case "PUBLIC KEY":
+		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			pub = cert.PublicKey
+		}
+	default:
+		return k, fmt.Errorf("unsupported PEM block '%s'", block.Type)
+	}
+	if err != nil {
+		return k, err
+	}
+	k.key = pub
+	return k, k.check()
+}
+
+// Тип ключа соответствует алгоритму
+func (k JWTKey) check() error {
+	switch key := k.key.(type) {
+	case *rsa.PublicKey:
+		if k.Alg == JWTAlgRS256 {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if k.Alg == JWTAlgES256 && key.Curve == elliptic.P256() {
+			return nil
+		}
+	case []byte:
+		if k.Alg == JWTAlgHS256 {
+			return nil
+		}
+	}
+	return fmt.Errorf("key %T is not suitable for %s", k.key, k.Alg)
+}
+
+type _JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+/*
+	Ключи из локального JWKS-файла (RFC 7517): RSA, EC P-256 и oct.
+	Ключи с use, отличным от "sig", пропускаются; без alg алгоритм выводится из kty.
+*/
+func LoadJWKSFile(path string) ([]JWTKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var jwks struct {
+		Keys []_JWK `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, err
+	}
+
+	var keys []JWTKey
+	for i, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		k, err := jwk.key()
+		if err != nil {
+			return nil, fmt.Errorf("key #%d (kid '%s'): %s", i, jwk.Kid, err)
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys in JWKS")
+	}
+	return keys, nil
+}
+
+func (jwk _JWK) key() (JWTKey, error) {
+	k := JWTKey{ID: jwk.Kid, Alg: jwk.Alg}
+	b64 := base64.RawURLEncoding
+
+	switch jwk.Kty {
+	case "RSA":
+		if k.Alg == "" {
+			k.Alg = JWTAlgRS256
+		}
+		n, errN := b64.DecodeString(jwk.N)
+		e, errE := b64.DecodeString(jwk.E)
+		if errN != nil || errE != nil || len(e) > 4 {
+			return k, errors.New("invalid RSA key")
+		}
+		k.key = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case "EC":
+		if k.Alg == "" {
+			k.Alg = JWTAlgES256
+		}
+		if jwk.Crv != "P-256" {
+			return k, fmt.Errorf("unsupported curve '%s'", jwk.Crv)
+		}
+		x, errX := b64.DecodeString(jwk.X)
+		y, errY := b64.DecodeString(jwk.Y)
+		if errX != nil || errY != nil {
+			return k, errors.New("invalid EC key")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return k, errors.New("EC point is not on curve")
+		}
+		k.key = pub
+	case "oct":
+		if k.Alg == "" {
+			k.Alg = JWTAlgHS256
+		}
+		secret, err := b64.DecodeString(jwk.K)
+		if err != nil || len(secret) == 0 {
+			return k, errors.New("invalid oct key")
+		}
+		k.key = secret
+	default:
+		return k, fmt.Errorf("unsupported kty '%s'", jwk.Kty)
+	}
+	return k, k.check()
+}
@@ -0,0 +1,236 @@
+package hollander
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/happywbfriends/nano/logger"
+	"github.com/happywbfriends/nano/xerror"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signJWT(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	b64 := base64.RawURLEncoding
+	h, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT", "kid": kid})
+	c, _ := json.Marshal(claims)
+	signed := b64.EncodeToString(h) + "." + b64.EncodeToString(c)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+func writePublicKeyPEM(t *testing.T, path string, pub interface{}) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJWTAuth_Verify(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	secret := []byte("top secret")
+
+	if err := os.WriteFile(filepath.Join(dir, "secret"), append(secret, '\n'), 0600); err != nil {
+		t.Fatal(err)
+	}
+	writePublicKeyPEM(t, filepath.Join(dir, "rsa.pem"), &rsaKey.PublicKey)
+	writePublicKeyPEM(t, filepath.Join(dir, "ec.pem"), &ecKey.PublicKey)
+
+	var keys []JWTKey
+	for _, f := range []struct{ alg, file string }{{JWTAlgHS256, "secret"}, {JWTAlgRS256, "rsa.pem"}, {JWTAlgES256, "ec.pem"}} {
+		k, err := LoadJWTKeyFile(f.alg, "", filepath.Join(dir, f.file))
+		if err != nil {
+			t.Fatalf("%s: %s", f.file, err)
+		}
+		keys = append(keys, k)
+	}
+	if _, err := LoadJWTKeyFile(JWTAlgES256, "", filepath.Join(dir, "rsa.pem")); err == nil {
+		t.Error("RSA key accepted for ES256")
+	}
+
+	now := time.Unix(1700000000, 0)
+	auth := NewJWTAuth(JWTConfig{Keys: keys, Issuer: "issuer", Audience: []string{"api"}, ClockSkew: time.Minute})
+	valid := map[string]interface{}{"sub": "42", "iss": "issuer", "aud": []string{"web", "api"}, "exp": now.Unix() + 60}
+
+	for alg, key := range map[string]interface{}{JWTAlgHS256: secret, JWTAlgRS256: rsaKey, JWTAlgES256: ecKey} {
+		if _, err := auth.Verify(signJWT(t, alg, "", key, valid), now); err != nil {
+			t.Errorf("%s: %s", alg, err)
+		}
+	}
+
+	claims := func(k string, v interface{}) map[string]interface{} {
+		c := map[string]interface{}{}
+		for k, v := range valid {
+			c[k] = v
+		}
+		c[k] = v
+		return c
+	}
+	tests := []struct {
+		name  string
+		token string
+		err   string
+	}{
+		{"expired within skew", signJWT(t, JWTAlgHS256, "", secret, claims("exp", now.Unix()-30)), ""},
+		{"expired", signJWT(t, JWTAlgHS256, "", secret, claims("exp", now.Unix()-60)), "token is expired"},
+		{"not yet valid", signJWT(t, JWTAlgHS256, "", secret, claims("nbf", now.Unix()+120)), "token is not valid yet"},
+		{"issuer", signJWT(t, JWTAlgHS256, "", secret, claims("iss", "other")), "invalid issuer"},
+		{"audience string", signJWT(t, JWTAlgHS256, "", secret, claims("aud", "api")), ""},
+		{"audience", signJWT(t, JWTAlgHS256, "", secret, claims("aud", "web")), "invalid audience"},
+		{"wrong secret", signJWT(t, JWTAlgHS256, "", []byte("guess"), valid), "invalid signature"},
+		// алгоритм берется из ключа, а не из токена
+		{"alg none", signJWT(t, "none", "", []byte{}, valid), "invalid signature"},
+		{"malformed", "abc.def", "malformed token"},
+	}
+	for _, tt := range tests {
+		_, err := auth.Verify(tt.token, now)
+		if (err == nil && tt.err != "") || (err != nil && err.Error() != tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestLoadJWKSFile(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	jwks := fmt.Sprintf(`{"keys": [
+		{"kty": "RSA", "kid": "r1", "use": "sig", "n": %q, "e": %q},
+		{"kty": "EC", "kid": "e1", "crv": "P-256", "x": %q, "y": %q},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": %q, "e": %q}
+	]}`, b64(rsaKey.N.Bytes()), b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+		b64(ecKey.X.FillBytes(make([]byte, 32))), b64(ecKey.Y.FillBytes(make([]byte, 32))),
+		b64(rsaKey.N.Bytes()), b64(big.NewInt(int64(rsaKey.E)).Bytes()))
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, []byte(jwks), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := LoadJWKSFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].Alg != JWTAlgRS256 || keys[1].Alg != JWTAlgES256 {
+		t.Fatalf("got keys %+v", keys)
+	}
+
+	auth := NewJWTAuth(JWTConfig{Keys: keys})
+	claims := map[string]interface{}{"sub": "42"}
+	if _, err := auth.Verify(signJWT(t, JWTAlgES256, "e1", ecKey, claims), time.Now()); err != nil {
+		t.Error(err)
+	}
+	if _, err := auth.Verify(signJWT(t, JWTAlgRS256, "e1", rsaKey, claims), time.Now()); err == nil {
+		t.Error("token with foreign kid accepted")
+	}
+}
+
+func TestJWTAuth_Handle(t *testing.T) {
+	secret := []byte("top secret")
+	key, err := ParseJWTKey(JWTAlgHS256, "", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := NewJWTAuth(JWTConfig{Keys: []JWTKey{key}, Realm: "api"})
+
+	var vals Values
+	mw := NewMiddleware(logger.NoLogger).Set("db", "main").Use(auth.Handle).
+		Use(func(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+			vals = mw.Values()
+			mw.SendText(http.StatusOK, "ok")
+			return false, nil
+		})
+
+	serve := func(auth string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if auth != "" {
+			r.Header.Set(HeaderAuthorization, auth)
+		}
+		w := httptest.NewRecorder()
+		mw.ServeHTTP(w, r)
+		return w
+	}
+
+	token := signJWT(t, JWTAlgHS256, "", secret, map[string]interface{}{"sub": "alice", "tenant": 7, "scope": "read write", "db": "other"})
+	if w := serve("bearer " + token); w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	// строки и целые числа в виде, пригодном для тегов Vat `context:"..."`
+	// по умолчанию с префиксом DefaultJWTClaimsPrefix, и значения, заданные через Set, не подменяются
+	if vals["jwt.sub"] != "alice" || vals["jwt.tenant"] != 7 || vals[ValuePrincipal] != "alice" || len(vals[ValueScopes].([]string)) != 2 ||
+		vals["db"] != "main" || vals["jwt.db"] != "other" {
+		t.Errorf("got values %v", vals)
+	}
+	if claims, ok := vals[ValueJWTClaims].(JWTClaims); !ok || claims["sub"] != "alice" {
+		t.Errorf("got claims %v", vals[ValueJWTClaims])
+	}
+
+	w := serve("")
+	if w.Code != http.StatusUnauthorized || w.Header().Get(HeaderWWWAuthenticate) != `Bearer realm="api"` {
+		t.Errorf("no token: got status %d, headers %v", w.Code, w.Header())
+	}
+	w = serve("Bearer " + token[:len(token)-2])
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Header().Get(HeaderWWWAuthenticate), `error="invalid_token"`) {
+		t.Errorf("bad token: got status %d, headers %v", w.Code, w.Header())
+	}
+}
+
+// Claims с именами ValuePrincipal и ValueScopes не подменяют значения, которые выставляет сам JWTAuth
+func TestJWTAuth_ReservedValues(t *testing.T) {
+	secret := []byte("top secret")
+	key, _ := ParseJWTKey(JWTAlgHS256, "", secret)
+	auth := NewJWTAuth(JWTConfig{Keys: []JWTKey{key}})
+	mw := authMiddleware("test_jwt_reserved", auth.Handle, RequireScopes("read"))
+
+	token := signJWT(t, JWTAlgHS256, "", secret, map[string]interface{}{
+		"sub": "alice", "scope": "read", ValuePrincipal: "root", ValueScopes: []string{"admin"},
+	})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+	mw.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.String() != "alice read" {
+		t.Errorf("got %d %q", w.Code, w.Body)
+	}
+}
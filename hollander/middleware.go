@@ -6,11 +6,14 @@ import (
 	"github.com/happywbfriends/nano/logger"
 	"github.com/happywbfriends/nano/xerror"
 	"net/http"
+	"runtime/debug"
 	"time"
 )
 
 // Ошибка в ответе имеет тип IHttpError, потому что для error всегда будет непонятно, считать ее 400 или 500
 type HttpHandler func(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError)
+
+// Вызывается вместо стандартной обработки паники, см. WithPanicHandler
 type PanicHandler func(w http.ResponseWriter, r *http.Request, mw IMiddleware, e interface{})
 
 type Values map[string]interface{}
@@ -24,6 +27,11 @@ type Middleware struct {
 	metricsEnabled bool
 	metrics        HTTPMetrics
 	maxReadBytes   int64
+	accessLog      *_AccessLogger // nullable
+	errorRenderer  ErrorRenderer  // nullable, тогда TextErrorRenderer
+	banner         *Banner        // nullable
+	cors           *CORS          // nullable
+	compressor     *_Compressor   // nullable
 }
 
 func NewMiddleware(log logger.ILogger) *Middleware {
@@ -33,20 +41,12 @@ func NewMiddleware(log logger.ILogger) *Middleware {
 }
 
 func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if m.panicHandler != nil {
-		defer func() {
-			if err := recover(); err != nil {
-				m.panicHandler(w, r, nil, err)
-			}
-		}()
-	}
-
-	// Надо сделать обработку 404, 405, иначе мы про них не узнаем, а нам надо банить тех, кто часто 400-ит
-
 	var startTm time.Time
 
-	if m.metricsEnabled {
+	if m.metricsEnabled || m.accessLog != nil {
 		startTm = time.Now()
+	}
+	if m.metricsEnabled {
 		m.metrics.NbReq.Inc()
 		m.metrics.NbCurrentConns.Inc()
 		defer m.metrics.NbCurrentConns.Dec()
@@ -71,6 +71,11 @@ func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set(HeaderRequestId, requestId)
 	}
 
+	// до хендлеров, чтобы браузер мог прочитать и ответ с ошибкой
+	if m.cors != nil {
+		m.cors.decorate(w.Header(), r)
+	}
+
 	// Timeout
 	if m.requestTimeout > 0 {
 		// For incoming server requests, the context is canceled when the client's connection closes,
@@ -87,18 +92,79 @@ func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		r.Body = http.MaxBytesReader(w, r.Body, m.maxReadBytes)
 	}
 
-	interceptor := newResponseStatusInterceptor(w)
+	// сжатие под _ResponseWriter: хендлеры и метрики видят несжатые байты
+	out := w
+	var cw *_CompressWriter
+	if m.compressor != nil {
+		cw = newCompressWriter(w, m.compressor, r)
+		out = cw
+	}
 
+	log := m.log.With("x-request-id", requestId)
 	rc := _RequestContext{
-		log:       m.log.With("x-request-id", requestId),
-		w:         interceptor,
+		log:       log,
+		w:         newResponseWriter(out, log),
 		r:         r,
 		vals:      vals,
 		requestId: requestId,
 	}
 
+	// 404 и 405 до Middleware не доходят, их засчитывает NanoRouter.Banner
+	banned := false
+	if m.banner != nil {
+		if left := m.banner.banLeft(r); left > 0 {
+			banned = true
+			rc.SetHeader(HeaderRetryAfter, seconds(left))
+			m.renderError(r, &rc, m.banner.banned)
+		}
+	}
+	if !banned {
+		m.runHandlers(r, &rc)
+	}
+	if cw != nil {
+		if err := cw.close(); err != nil {
+			log.Warnf("Error writing compressed response: %s", err)
+		}
+	}
+
+	statusCode := rc.w.effectiveStatus()
+
+	if m.metricsEnabled {
+		if statusCode >= 400 && statusCode <= 499 {
+			m.metrics.NbReq4xx.Inc()
+		} else if statusCode >= 500 && statusCode <= 599 {
+			m.metrics.NbReq5xx.Inc()
+		} else {
+			m.metrics.NbReq2xx.Inc()
+			m.metrics.Latency2xxMillis.Observe(time.Since(startTm).Seconds())
+		}
+	}
+
+	if m.banner != nil && !banned {
+		m.banner.record(r, statusCode)
+	}
+
+	if m.accessLog != nil {
+		m.accessLog.write(m.log, &_AccessRecord{
+			r:         r,
+			requestId: requestId,
+			status:    statusCode,
+			bytes:     rc.w.bytes,
+			latency:   time.Since(startTm),
+			ttfb:      rc.w.ttfb,
+		})
+	}
+}
+
+func (m *Middleware) runHandlers(r *http.Request, rc *_RequestContext) {
+	defer func() {
+		if e := recover(); e != nil {
+			m.handlePanic(r, rc, e)
+		}
+	}()
+
 	for _, h := range m.handlers {
-		proceed, xe := h(r, &rc)
+		proceed, xe := h(r, rc)
 		if xe != nil {
 
 			publicMessage := xe.PublicMessage()
@@ -113,33 +179,73 @@ func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				rc.log.Warnf("%s %s: %+v", r.Method, r.RequestURI, xe)
 			}
 
-			statusCode := xe.HttpStatus()
-			if statusCode == 0 {
-				statusCode = http.StatusInternalServerError
+			if m.metricsEnabled {
+				switch xe.(type) {
+				case *_RateLimitedError:
+					m.metrics.NbRateLimited.Inc()
+				case *_AuthFailedError:
+					m.metrics.NbAuthFailed.Inc()
+				}
 			}
-			if publicMessage != "" {
-				rc.SendText(statusCode, publicMessage)
-			} else {
-				rc.Send(statusCode, "", nil)
+			if rc.w.headersSent {
+				// хендлер уже начал отвечать, второй ответ только испортит первый
+				break
 			}
+			m.renderError(r, rc, xe)
 			break
 		} else if !proceed {
 			break
 		}
 	}
+}
 
-	statusCode := rc.w.statusCode
-
+/*
+	Паника в HttpHandler-е не роняет соединение: она считается в метриках и передается panicHandler-у,
+	а без него логируется со стеком, и клиенту отдается 500 (если заголовки ответа еще не были отправлены).
+	http.ErrAbortHandler пробрасывается дальше: это штатный способ оборвать ответ.
+*/
+func (m *Middleware) handlePanic(r *http.Request, rc *_RequestContext, e interface{}) {
+	if e == http.ErrAbortHandler {
+		panic(e)
+	}
 	if m.metricsEnabled {
-		if statusCode >= 400 && statusCode <= 499 {
-			m.metrics.NbReq4xx.Inc()
-		} else if statusCode >= 500 && statusCode <= 599 {
-			m.metrics.NbReq5xx.Inc()
-		} else {
-			m.metrics.NbReq2xx.Inc()
-			m.metrics.Latency2xxMillis.Observe(time.Since(startTm).Seconds())
-		}
+		m.metrics.NbPanics.Inc()
+	}
+
+	if m.panicHandler != nil {
+		m.panicHandler(rc.w, r, rc, e)
+		return
+	}
+
+	rc.log.Errorf("%s %s: panic: %v\n%s", r.Method, r.RequestURI, e, debug.Stack())
+	if !rc.w.headersSent {
+		m.renderError(r, rc, internalError)
+	}
+}
+
+var internalError = xerror.NewFailure(http.StatusText(http.StatusInternalServerError))
+
+func (m *Middleware) renderError(r *http.Request, rc *_RequestContext, xe xerror.IError) {
+	statusCode := xe.HttpStatus()
+	if statusCode == 0 {
+		statusCode = http.StatusInternalServerError
+	}
+	render := m.errorRenderer
+	if render == nil {
+		render = TextErrorRenderer
+	}
+	render(r, rc, statusCode, xe)
+}
+
+// Копия настроек. Хендлеры и значения копируются, чтобы изменения копии не затрагивали оригинал
+func (m *Middleware) clone() Middleware {
+	c := *m
+	c.handlers = append([]HttpHandler(nil), m.handlers...)
+	c.values = nil
+	for k, v := range m.values {
+		c.Set(k, v)
 	}
+	return c
 }
 
 func (m *Middleware) Set(k string, v interface{}) *Middleware {
@@ -167,6 +273,41 @@ func (m *Middleware) WithTimeoutContext(timeout time.Duration) *Middleware {
 	return m
 }
 
+// Включает access-лог, см. AccessLog
+func (m *Middleware) WithAccessLog(cfg AccessLog) *Middleware {
+	m.accessLog = &_AccessLogger{AccessLog: cfg}
+	return m
+}
+
+// Формат ответа с ошибкой: TextErrorRenderer, ProblemJSONErrorRenderer, NegotiatedErrorRenderer или свой
+func (m *Middleware) WithErrorRenderer(render ErrorRenderer) *Middleware {
+	m.errorRenderer = render
+	return m
+}
+
+// Засчитывать 4xx клиенту и не пускать забаненных, см. Banner
+func (m *Middleware) WithBanner(b *Banner) *Middleware {
+	m.banner = b
+	return m
+}
+
+// CORS-заголовки в ответах. На preflight отвечает NanoRouter.CORS
+func (m *Middleware) WithCORS(c *CORS) *Middleware {
+	m.cors = c
+	return m
+}
+
+// Сжатие ответов gzip/deflate по Accept-Encoding, см. Compression
+func (m *Middleware) WithCompression(cfg Compression) *Middleware {
+	m.compressor = newCompressor(cfg)
+	return m
+}
+
+func (m *Middleware) WithPanicHandler(h PanicHandler) *Middleware {
+	m.panicHandler = h
+	return m
+}
+
 func (m *Middleware) WithMaxBytesReader(maxBytes int64) *Middleware {
 	m.maxReadBytes = maxBytes
 	return m
@@ -0,0 +1,191 @@
+package hollander
+
+import (
+	"fmt"
+	"github.com/happywbfriends/nano/logger"
+	"github.com/happywbfriends/nano/xerror"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Логгер, запоминающий строки вместе с полями, добавленными через With
+type _TestLogger struct {
+	fields string
+	mu     *sync.Mutex
+	lines  *[]string
+}
+
+func newTestLogger() *_TestLogger {
+	return &_TestLogger{mu: &sync.Mutex{}, lines: &[]string{}}
+}
+
+func (l *_TestLogger) With(k, v string) logger.ILogger {
+	c := *l
+	c.fields += k + "=" + v + " "
+	return &c
+}
+
+func (l *_TestLogger) log(level, f string, p ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	*l.lines = append(*l.lines, level+" "+l.fields+fmt.Sprintf(f, p...))
+}
+
+func (l *_TestLogger) Errorf(f string, p ...interface{}) { l.log("ERR", f, p...) }
+func (l *_TestLogger) Warnf(f string, p ...interface{})  { l.log("WRN", f, p...) }
+func (l *_TestLogger) Infof(f string, p ...interface{})  { l.log("INF", f, p...) }
+func (l *_TestLogger) Debugf(f string, p ...interface{}) { l.log("DBG", f, p...) }
+
+func (l *_TestLogger) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), *l.lines...)
+}
+
+func TestMiddleware_Panic(t *testing.T) {
+	panicking := func(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+		if r.URL.Query().Get("write") != "" {
+			mw.SendText(http.StatusAccepted, "partial")
+		}
+		panic("boom")
+	}
+
+	log := newTestLogger()
+	mw := NewMiddleware(log).WithMetrics("test_panic", "GET /panic").Use(panicking)
+
+	r := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	r.Header.Set(HeaderRequestId, "req-1")
+	w := httptest.NewRecorder()
+	mw.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d, want 500", w.Code)
+	}
+	lines := log.Lines()
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "ERR x-request-id=req-1 GET /panic: panic: boom") || !strings.Contains(lines[0], "goroutine") {
+		t.Errorf("got log %q", lines)
+	}
+
+	// заголовки уже ушли - статус не меняется
+	w = httptest.NewRecorder()
+	mw.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic?write=1", nil))
+	if w.Code != http.StatusAccepted || w.Body.String() != "partial" {
+		t.Errorf("got status %d, body '%s'", w.Code, w.Body.String())
+	}
+
+	if n := testutil.ToFloat64(mw.metrics.NbPanics); n != 2 {
+		t.Errorf("got %v panics in metrics, want 2", n)
+	}
+}
+
+func TestMiddleware_PanicHandler(t *testing.T) {
+	var gotRequestId string
+	mw := NewMiddleware(logger.NoLogger).
+		Use(func(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+			panic(fmt.Errorf("boom"))
+		}).
+		WithPanicHandler(func(w http.ResponseWriter, r *http.Request, mw IMiddleware, e interface{}) {
+			gotRequestId = mw.RequestId()
+			mw.SendText(http.StatusServiceUnavailable, fmt.Sprint(e))
+		})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(HeaderRequestId, "req-2")
+	w := httptest.NewRecorder()
+	mw.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "boom" || gotRequestId != "req-2" {
+		t.Errorf("got status %d, body '%s', request id '%s'", w.Code, w.Body.String(), gotRequestId)
+	}
+}
+
+func TestMiddleware_AbortHandlerPanic(t *testing.T) {
+	mw := NewMiddleware(logger.NoLogger).Use(func(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+		panic(http.ErrAbortHandler)
+	})
+	defer func() {
+		if e := recover(); e != http.ErrAbortHandler {
+			t.Errorf("got %v, want http.ErrAbortHandler to propagate", e)
+		}
+	}()
+	mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestMiddleware_AccessLog(t *testing.T) {
+	reply := func(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+		if r.URL.Query().Get("fail") != "" {
+			return false, xerror.NewBadRequest("bad")
+		}
+		mw.SendText(http.StatusOK, "hello")
+		return false, nil
+	}
+
+	log := newTestLogger()
+	router := NewRouter()
+	router.Group("").WithAccessLog(AccessLog{Log: log, Sample2xx: 3}).Serve(http.MethodGet, "/orders/:id", reply)
+
+	serve := func(uri string) {
+		r := httptest.NewRequest(http.MethodGet, uri, nil)
+		r.Header.Set(HeaderRequestId, "req")
+		r.Header.Set("User-Agent", "test-agent")
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	for i := 0; i < 4; i++ {
+		serve("/orders/1")
+	}
+	serve("/orders/2?fail=1")
+
+	expected := []string{
+		"INF x-request-id=req method=GET route=/orders/:id path=/orders/1 status=200 bytes=5 latency_ms=",
+		"INF x-request-id=req method=GET route=/orders/:id path=/orders/1 status=200 bytes=5 latency_ms=",
+		"INF x-request-id=req method=GET route=/orders/:id path=/orders/2 status=400 bytes=3 latency_ms=",
+	}
+	var access []string
+	for _, line := range log.Lines() {
+		if strings.HasSuffix(line, " access") {
+			access = append(access, line)
+		}
+	}
+	if len(access) != len(expected) {
+		t.Fatalf("got %d access lines, want %d: %q", len(access), len(expected), access)
+	}
+	for i, line := range access {
+		if !strings.HasPrefix(line, expected[i]) || !strings.Contains(line, "remote_addr=192.0.2.1:1234 user_agent=test-agent") {
+			t.Errorf("got line %q, want prefix %q", line, expected[i])
+		}
+	}
+}
+
+func TestMiddleware_AccessLogSlowAndCombined(t *testing.T) {
+	log := newTestLogger()
+	mw := NewMiddleware(log).
+		WithAccessLog(AccessLog{Format: AccessLogCombined, Sample2xx: 1000, SlowThreshold: time.Nanosecond}).
+		Use(func(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+			time.Sleep(time.Millisecond)
+			mw.SendText(http.StatusCreated, "ok")
+			return false, nil
+		})
+
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest(http.MethodPost, "/items?a=1", nil)
+		r.Header.Set(HeaderRequestId, "req")
+		r.Header.Set("Referer", "http://example.com/")
+		r.SetBasicAuth("alice", "secret")
+		mw.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	lines := log.Lines()
+	if len(lines) != 2 {
+		t.Fatalf("slow requests should bypass sampling, got %q", lines)
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "WRN x-request-id=req 192.0.2.1 - alice [") ||
+			!strings.HasSuffix(line, `] "POST /items?a=1 HTTP/1.1" 201 2 "http://example.com/" "-"`) {
+			t.Errorf("got line %q", line)
+		}
+	}
+}
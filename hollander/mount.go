@@ -0,0 +1,139 @@
+package hollander
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type _Mount struct {
+	prefix        string // без слэша в конце, "" для корня
+	escapedPrefix string // prefix в виде, в котором он встречается в URL.RawPath
+	h             http.Handler
+}
+
+// Роутер, в который смонтирован текущий, и исходный запрос к нему
+type _Mounted struct {
+	router *NanoRouter
+	r      *http.Request
+	prefix string // отрезанный префикс
+	up     *_Mounted
+}
+
+/*
+	Монтирует h под статическим префиксом: запросы на prefix и prefix/... любым методом передаются в h
+	с отрезанным префиксом (/billing/invoices -> /invoices, /billing -> /).
+
+	Роуты, явно зарегистрированные в этом роутере под тем же префиксом, приоритетнее монтирования.
+	Если h - это *NanoRouter со стандартными NotFound/MethodNotAllowed, то они делегируются этому роутеру.
+*/
+func (router *NanoRouter) Mount(prefix string, h http.Handler) {
+	if h == nil {
+		panic("handler is nil")
+	}
+	prefix = normalizePrefix(prefix)
+	if indexParamStart(prefix+"/") != -1 {
+		panic(fmt.Sprintf("mount prefix '%s' should be static", prefix))
+	}
+
+	m := &_Mount{
+		prefix:        prefix,
+		escapedPrefix: (&url.URL{Path: prefix}).EscapedPath(),
+		h:             h,
+	}
+
+	router.update(func(t *_RouteTable) {
+		if t.paramRoutes == nil {
+			t.paramRoutes = &_Node{}
+		}
+		node, err := t.paramRoutes.insert(prefix+"/*", []_Token{{nodeStatic, prefix + "/", nil}, {nodeCatchAll, "", nil}})
+		if err != nil {
+			panic(fmt.Sprintf("mount %s: %s", prefix, err))
+		}
+		if node.route != nil {
+			panic(fmt.Sprintf("mount %s: prefix is already mounted", prefix))
+		}
+		node.route = &_Route{template: prefix + "/*", mount: m}
+
+		if prefix != "" {
+			if rt := t.staticRoutes[prefix]; rt != nil {
+				panic(fmt.Sprintf("mount %s: route %s already exists", prefix, prefix))
+			}
+			t.staticRoutes[prefix] = &_Route{template: prefix, mount: m}
+		}
+		router.checkStrict(t, node.route)
+	})
+}
+
+// Удаляет монтирование, сделанное Mount. Возвращает, было ли оно
+func (router *NanoRouter) Unmount(prefix string) (removed bool) {
+	prefix = normalizePrefix(prefix)
+
+	router.update(func(t *_RouteTable) {
+		if t.paramRoutes == nil {
+			return
+		}
+		node := t.paramRoutes.findNode([]_Token{{nodeStatic, prefix + "/", nil}, {nodeCatchAll, "", nil}})
+		if node == nil || node.route == nil || node.route.mount == nil {
+			return
+		}
+		removed = true
+		node.route = nil
+		t.paramRoutes.prune()
+		if prefix != "" {
+			delete(t.staticRoutes, prefix)
+		}
+	})
+	return removed
+}
+
+func (g *RouteGroup) Mount(prefix string, h http.Handler) {
+	g.router.Mount(g.prefix+normalizePrefix(prefix), h)
+}
+
+// Все монтирования таблицы
+func (t *_RouteTable) mounts() []*_Mount {
+	var mounts []*_Mount
+	if t.paramRoutes != nil {
+		t.paramRoutes.walk(func(n *_Node) {
+			if n.route != nil && n.route.mount != nil {
+				mounts = append(mounts, n.route.mount)
+			}
+		})
+	}
+	return mounts
+}
+
+func (router *NanoRouter) serveMount(w http.ResponseWriter, r *http.Request, m *_Mount, up *_Mounted) {
+	stripped := m.strip(r)
+	if sub, ok := m.h.(*NanoRouter); ok {
+		sub.serve(w, stripped, &_Mounted{router: router, r: r, prefix: m.prefix, up: up})
+		return
+	}
+	m.h.ServeHTTP(w, stripped)
+}
+
+// Копия запроса с отрезанным префиксом, аналогично http.StripPrefix
+func (m *_Mount) strip(r *http.Request) *http.Request {
+	p := strings.TrimPrefix(r.URL.Path, m.prefix)
+	if p == "" {
+		p = "/"
+	}
+
+	rp := ""
+	if r.URL.RawPath != "" && strings.HasPrefix(r.URL.RawPath, m.escapedPrefix) {
+		rp = strings.TrimPrefix(r.URL.RawPath, m.escapedPrefix)
+		if rp == "" {
+			rp = "/"
+		}
+	}
+
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = p
+	r2.URL.RawPath = rp
+	return r2
+}
@@ -0,0 +1,113 @@
+package hollander
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNanoRouter_Mount(t *testing.T) {
+	echo := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(name + " " + r.URL.Path + " " + r.URL.RawPath))
+		}
+	}
+
+	billing := NewRouter()
+	billing.HandleFunc("GET", "/invoices/:id", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("invoice " + PathParam(r, "id")))
+	})
+
+	router := NewRouter()
+	router.HandleFunc("GET", "/debug/health", echo("health"))
+	router.Mount("/debug/", echo("debug"))
+	router.Mount("/billing", billing)
+	router.Group("/api").Mount("/files", echo("files"))
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("parent 404 " + r.URL.Path))
+	})
+	router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		_, _ = w.Write([]byte("parent 405 " + r.URL.Path))
+	})
+
+	tests := []struct {
+		method         string
+		callUri        string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"GET", "/debug/health", http.StatusOK, "health /debug/health "},
+		{"GET", "/debug/pprof/heap", http.StatusOK, "debug /pprof/heap "},
+		{"POST", "/debug", http.StatusOK, "debug / "},
+		{"GET", "/debug/a%2Fb", http.StatusOK, "debug /a/b /a%2Fb"},
+		{"GET", "/api/files/x/y.txt", http.StatusOK, "files /x/y.txt "},
+		{"GET", "/billing/invoices/7", http.StatusOK, "invoice 7"},
+		{"GET", "/billing/unknown", http.StatusNotFound, "parent 404 /billing/unknown"},
+		{"DELETE", "/billing/invoices/7", http.StatusMethodNotAllowed, "parent 405 /billing/invoices/7"},
+		{"GET", "/debugger", http.StatusNotFound, "parent 404 /debugger"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.callUri, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.callUri, nil))
+			if w.Code != tt.expectedStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.expectedStatus)
+			}
+			if w.Body.String() != tt.expectedBody {
+				t.Errorf("got body '%s', want '%s'", w.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestNanoRouter_MountConflicts(t *testing.T) {
+	for name, register := range map[string]func(router *NanoRouter){
+		"param prefix":  func(router *NanoRouter) { router.Mount("/a/:id", http.NotFoundHandler()) },
+		"double mount":  func(router *NanoRouter) { router.Mount("/m", http.NotFoundHandler()) },
+		"route on path": func(router *NanoRouter) { router.Handle("GET", "/m", http.NotFoundHandler()) },
+		"catch-all":     func(router *NanoRouter) { router.Handle("GET", "/m/*rest", http.NotFoundHandler()) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			router := NewRouter()
+			router.Mount("/m", http.NotFoundHandler())
+			defer func() {
+				if recover() == nil {
+					t.Error("expected panic")
+				}
+			}()
+			register(router)
+		})
+	}
+}
+
+// Один роутер в разных монтированиях дает разные шаблоны для логов и метрик
+func TestNanoRouter_MountRouteTemplate(t *testing.T) {
+	template := func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(RouteTemplate(r)))
+	}
+
+	sub := NewRouter()
+	sub.HandleFunc("GET", "/invoices/:id", template)
+	sub.HandleFunc("GET", "/status", template)
+	v1 := NewRouter()
+	v1.Mount("/billing", sub)
+
+	router := NewRouter()
+	router.Mount("/shop", sub)
+	router.Mount("/v1", v1)
+
+	for uri, expected := range map[string]string{
+		"/shop/invoices/7":       "/shop/invoices/:id",
+		"/shop/status":           "/shop/status",
+		"/v1/billing/invoices/7": "/v1/billing/invoices/:id",
+		"/v1/billing/status":     "/v1/billing/status",
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, uri, nil))
+		if w.Body.String() != expected {
+			t.Errorf("%s: got '%s', want '%s'", uri, w.Body.String(), expected)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package hollander
+
+import (
+	"fmt"
+	"github.com/happywbfriends/nano/xerror"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+/*
+	Условие роута на Content-Type тела запроса (без параметров вроде charset, без учета регистра).
+	Допускаются маски "application/*" и "*\/*". Если ни один вариант роута не подошел только из-за
+	Content-Type, роутер отвечает 415 (см. NanoRouter.UnsupportedMediaType).
+
+	router.HandleIf(Consumes(ContentTypeJSON), http.MethodPost, "/orders", createFromJSON)
+	router.HandleIf(Consumes(ContentTypeForm), http.MethodPost, "/orders", createFromForm)
+*/
+func Consumes(mediaTypes ...string) RouteCondition {
+	if len(mediaTypes) == 0 {
+		panic("no media types")
+	}
+	c := &_ConsumesCondition{}
+	for _, mt := range mediaTypes {
+		c.mediaTypes = append(c.mediaTypes, strings.ToLower(mt))
+	}
+	return c
+}
+
+type _ConsumesCondition struct {
+	mediaTypes []string
+}
+
+func (c *_ConsumesCondition) Match(r *http.Request) bool {
+	mt := requestMediaType(r)
+	if mt == "" {
+		return false
+	}
+	for _, offer := range c.mediaTypes {
+		if mediaTypeMatches(offer, mt) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *_ConsumesCondition) String() string {
+	return "consumes " + strings.Join(c.mediaTypes, ", ")
+}
+
+// Условие не выполнено, но только из-за Consumes
+func failsOnContentTypeOnly(cond RouteCondition, r *http.Request) bool {
+	switch c := cond.(type) {
+	case *_ConsumesCondition:
+		return !c.Match(r)
+	case _AllConditions:
+		failed := false
+		for _, sub := range c {
+			if sub.Match(r) {
+				continue
+			}
+			if !failsOnContentTypeOnly(sub, r) {
+				return false
+			}
+			failed = true
+		}
+		return failed
+	}
+	return false
+}
+
+// Content-Type запроса без параметров, в нижнем регистре. "" если не задан или некорректен
+func requestMediaType(r *http.Request) string {
+	ct := r.Header.Get(HeaderContentType)
+	if ct == "" {
+		return ""
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return ""
+	}
+	return mt
+}
+
+// pattern может быть маской type/* или */*
+func mediaTypeMatches(pattern, mediaType string) bool {
+	if pattern == "*/*" || pattern == mediaType {
+		return true
+	}
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(mediaType, pattern[:len(pattern)-1])
+	}
+	return false
+}
+
+// Элемент заголовка Accept
+type _MediaRange struct {
+	mediaType string
+	q         float64
+}
+
+// Элементы с некорректным синтаксисом пропускаются. Параметры, кроме q, не учитываются
+func parseAccept(header string) []_MediaRange {
+	var ranges []_MediaRange
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		mt, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qs, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, _MediaRange{mediaType: mt, q: q})
+	}
+	return ranges
+}
+
+/*
+	q, с которым клиент принимает offer: берется самый конкретный из подходящих элементов
+	(text/csv > text/* > *\/*). -1, если не подошел ни один.
+*/
+func acceptQuality(ranges []_MediaRange, offer string) float64 {
+	q, specificity := -1.0, -1
+	for _, mr := range ranges {
+		if !mediaTypeMatches(mr.mediaType, offer) {
+			continue
+		}
+		s := 2
+		if mr.mediaType == "*/*" {
+			s = 0
+		} else if strings.HasSuffix(mr.mediaType, "/*") {
+			s = 1
+		}
+		if s > specificity {
+			q, specificity = mr.q, s
+		}
+	}
+	return q
+}
+
+/*
+	Выбирает из offers тип ответа по заголовку Accept: с наибольшим q, при равенстве - первый в offers.
+	Без Accept (или если он целиком некорректен) - первый из offers.
+	Если клиент не принимает ни один из offers, возвращает ошибку с кодом 406, которую можно вернуть из HttpHandler:
+
+	ct, e := mw.Negotiate(ContentTypeJSON, ContentTypeCSV)
+	if e != nil {
+		return false, e
+	}
+*/
+func Negotiate(r *http.Request, offers ...string) (string, xerror.IError) {
+	if len(offers) == 0 {
+		return "", xerror.NewFailureDetailed("internal error", "Negotiate: no offers")
+	}
+
+	ranges := parseAccept(strings.Join(r.Header.Values(HeaderAccept), ","))
+	if len(ranges) == 0 {
+		return offers[0], nil
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(ranges, strings.ToLower(offer)); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	if best == "" {
+		return "", xerror.NewCustom(http.StatusNotAcceptable, 0, fmt.Sprintf("Not acceptable. Available: %s", strings.Join(offers, ", ")))
+	}
+	return best, nil
+}
@@ -0,0 +1,118 @@
+package hollander
+
+import (
+	"github.com/happywbfriends/nano/logger"
+	"github.com/happywbfriends/nano/xerror"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	const csv = "text/csv"
+	tests := []struct {
+		accept       string
+		offers       []string
+		expected     string
+		expectedCode int
+	}{
+		{"", []string{ContentTypeJSON, csv}, ContentTypeJSON, 0},
+		{"text/csv", []string{ContentTypeJSON, csv}, csv, 0},
+		{"text/csv;q=0.5, application/json", []string{csv, ContentTypeJSON}, ContentTypeJSON, 0},
+		{"text/*;q=0.9, */*;q=0.1", []string{ContentTypeJSON, csv}, csv, 0},
+		{"*/*", []string{ContentTypeJSON, csv}, ContentTypeJSON, 0},
+		{"application/json;q=0, */*", []string{ContentTypeJSON, csv}, csv, 0}, // конкретный q=0 важнее */*
+		{"TEXT/CSV", []string{ContentTypeJSON, csv}, csv, 0},
+		{"text/html", []string{ContentTypeJSON, csv}, "", http.StatusNotAcceptable},
+		{"text/csv;q=0", []string{csv}, "", http.StatusNotAcceptable},
+		{"garbage;;;", []string{ContentTypeJSON, csv}, ContentTypeJSON, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				r.Header.Set(HeaderAccept, tt.accept)
+			}
+			got, e := Negotiate(r, tt.offers...)
+			if tt.expectedCode != 0 {
+				if e == nil || e.HttpStatus() != tt.expectedCode {
+					t.Fatalf("got '%s' %v, want status %d", got, e, tt.expectedCode)
+				}
+				return
+			}
+			if e != nil || got != tt.expected {
+				t.Errorf("got '%s' %v, want '%s'", got, e, tt.expected)
+			}
+		})
+	}
+}
+
+func TestConsumesRouting(t *testing.T) {
+	router := NewRouter()
+	router.HandleFuncIf(Consumes(ContentTypeJSON), http.MethodPost, "/orders", replyText("json"))
+	router.HandleFuncIf(Consumes(ContentTypeForm, "multipart/*"), http.MethodPost, "/orders", replyText("form"))
+	router.HandleFuncIf(All(Host("a.local"), Consumes(ContentTypeJSON)), http.MethodPut, "/orders", replyText("a json"))
+
+	tests := []struct {
+		method       string
+		host         string
+		contentType  string
+		expectedCode int
+		expectedBody string
+	}{
+		{http.MethodPost, "", "application/json; charset=utf-8", http.StatusOK, "json"},
+		{http.MethodPost, "", ContentTypeForm, http.StatusOK, "form"},
+		{http.MethodPost, "", "multipart/form-data; boundary=x", http.StatusOK, "form"},
+		{http.MethodPost, "", "text/csv", http.StatusUnsupportedMediaType, ""},
+		{http.MethodPost, "", "", http.StatusUnsupportedMediaType, ""},
+		{http.MethodPut, "a.local", ContentTypeJSON, http.StatusOK, "a json"},
+		{http.MethodPut, "a.local", "text/csv", http.StatusUnsupportedMediaType, ""},
+		{http.MethodPut, "b.local", "text/csv", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.host+" "+tt.contentType, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/orders", strings.NewReader("{}"))
+			if tt.host != "" {
+				r.Host = tt.host
+			}
+			if tt.contentType != "" {
+				r.Header.Set(HeaderContentType, tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != tt.expectedCode {
+				t.Fatalf("got status %d, want %d", w.Code, tt.expectedCode)
+			}
+			if tt.expectedBody != "" && w.Body.String() != tt.expectedBody {
+				t.Errorf("got body '%s', want '%s'", w.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestMiddlewareNegotiate(t *testing.T) {
+	mw := NewMiddleware(logger.NoLogger).Use(func(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+		ct, e := mw.Negotiate(ContentTypeJSON, ContentTypeText)
+		if e != nil {
+			return false, e
+		}
+		mw.Send(http.StatusOK, ct, []byte("ok"))
+		return false, nil
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(HeaderAccept, "text/plain, application/json;q=0.5")
+	w := httptest.NewRecorder()
+	mw.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get(HeaderContentType) != ContentTypeText {
+		t.Errorf("got status %d, content type '%s'", w.Code, w.Header().Get(HeaderContentType))
+	}
+
+	r.Header.Set(HeaderAccept, "image/png")
+	w = httptest.NewRecorder()
+	mw.ServeHTTP(w, r)
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("got status %d, want 406", w.Code)
+	}
+}
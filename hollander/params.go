@@ -0,0 +1,146 @@
+package hollander
+
+import (
+	"context"
+	"fmt"
+	"github.com/happywbfriends/nano/xerror"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Значение path-параметра, найденное роутером
+type Param struct {
+	Name  string
+	Value string
+}
+
+// Параметры в порядке их следования в шаблоне
+type Params []Param
+
+func (ps Params) Get(name string) (value string, found bool) {
+	for i := range ps {
+		if ps[i].Name == name {
+			return ps[i].Value, true
+		}
+	}
+	return "", false
+}
+
+func (ps Params) ByName(name string) string {
+	v, _ := ps.Get(name)
+	return v
+}
+
+// Ключ контекста неэкспортируемого типа, чтобы не пересекаться с другими пакетами
+type _ParamsKey struct{}
+
+/*
+	Контекст с параметрами. Сам является значением по ключу _ParamsKey, поэтому
+	на каждый запрос с параметрами приходится одна аллокация (если параметров не больше maxInlineParams),
+	а не по context.WithValue на каждый параметр.
+*/
+type _ParamsContext struct {
+	context.Context
+	template string // шаблон найденного роута, см. RouteTemplate
+	params   Params
+	buf      [maxInlineParams]Param
+}
+
+func (c *_ParamsContext) Value(key interface{}) interface{} {
+	if _, ok := key.(_ParamsKey); ok {
+		return c
+	}
+	return c.Context.Value(key)
+}
+
+/*
+	Копия запроса вместе с контекстом параметров - одна аллокация на запрос, а с NanoRouter.PoolRequests - ни одной.
+	r.WithContext инлайнится, и копия запроса, которую он создает, не убегает в кучу.
+*/
+type _ParamsRequest struct {
+	r   http.Request
+	ctx _ParamsContext
+}
+
+var paramsRequestPool = sync.Pool{
+	New: func() interface{} { return new(_ParamsRequest) },
+}
+
+// См. NanoRouter.PoolRequests
+func acquireParamsRequest(r *http.Request, template string, params Params) *_ParamsRequest {
+	pr := paramsRequestPool.Get().(*_ParamsRequest)
+	pr.init(r, template, params)
+	return pr
+}
+
+func (pr *_ParamsRequest) init(r *http.Request, template string, params Params) {
+	pr.ctx.Context = r.Context()
+	pr.ctx.template = template
+	pr.ctx.params = nil
+	if len(params) > 0 {
+		pr.ctx.params = append(pr.ctx.buf[:0], params...)
+	}
+	pr.r = *r.WithContext(&pr.ctx)
+}
+
+// Обнуляем ссылки, чтобы пул не удерживал тела запросов и значения параметров
+func (pr *_ParamsRequest) release() {
+	pr.r = http.Request{}
+	pr.ctx = _ParamsContext{}
+	paramsRequestPool.Put(pr)
+}
+
+// Без пула: запрос и контекст - одна аллокация, которая живет, пока на запрос есть ссылки
+func withParams(r *http.Request, template string, params Params) *http.Request {
+	pr := new(_ParamsRequest)
+	pr.init(r, template, params)
+	return &pr.r
+}
+
+// Все path-параметры, найденные NanoRouter для запроса. nil, если их нет
+func PathParams(r *http.Request) Params {
+	return paramsFromContext(r.Context())
+}
+
+func paramsFromContext(ctx context.Context) Params {
+	if pc, ok := ctx.Value(_ParamsKey{}).(*_ParamsContext); ok {
+		return pc.params
+	}
+	return nil
+}
+
+/*
+	Шаблон роута NanoRouter, обслуживающего запрос (/orders/:id), для логов и метрик.
+	У статических роутов шаблон совпадает с путем, поэтому для них (и для запросов не через NanoRouter) это r.URL.Path.
+	Для смонтированных роутеров к шаблону добавляются префиксы монтирования (/billing/invoices/:id),
+	чтобы метки разных монтирований одного роутера не совпадали.
+*/
+func RouteTemplate(r *http.Request) string {
+	if pc, ok := r.Context().Value(_ParamsKey{}).(*_ParamsContext); ok {
+		return pc.template
+	}
+	return r.URL.Path
+}
+
+// Значение path-параметра или пустая строка
+func PathParam(r *http.Request, name string) string {
+	return PathParams(r).ByName(name)
+}
+
+func PathParamInt(r *http.Request, name string) (int, xerror.IError) {
+	return paramInt(PathParams(r), name)
+}
+
+func paramInt(ps Params, name string) (int, xerror.IError) {
+	strVal, found := ps.Get(name)
+	if !found {
+		// шаблон роута не содержит такого параметра - ошибка программиста, а не клиента
+		return 0, xerror.NewFailureDetailed("internal error", fmt.Sprintf("path parameter '%s' is not declared in route", name))
+	}
+	intVal, err := strconv.Atoi(strVal)
+	if err != nil {
+		return 0, xerror.NewBadRequest(fmt.Sprintf("path parameter '%s=%s' is not a valid integer", name, strVal))
+	}
+	return intVal, nil
+}
@@ -3,61 +3,85 @@ package hollander
 import "github.com/prometheus/client_golang/prometheus"
 
 func newCounter(ns, name, method string) prometheus.Counter {
+	c := makeCounter(ns, name, method)
+	prometheus.MustRegister(c)
+	return c
+}
 
-	var labels prometheus.Labels
-	if method != "" {
-		labels = map[string]string{
-			"method": method,
-		}
+func newGauge(ns, name, method string) prometheus.Gauge {
+	g := makeGauge(ns, name, method)
+	prometheus.MustRegister(g)
+	return g
+}
+
+func newSummary(ns, name, method string) prometheus.Summary {
+	s := makeSummary(ns, name, method)
+	prometheus.MustRegister(s)
+	return s
+}
+
+func newGaugeFunc(ns, name string, f func() float64) prometheus.GaugeFunc {
+	g := prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: ns,
+			Name:      name,
+		}, f)
+	prometheus.MustRegister(g)
+	return g
+}
+
+func methodLabels(method string) prometheus.Labels {
+	if method == "" {
+		return nil
 	}
+	return map[string]string{
+		"method": method,
+	}
+}
 
-	c := prometheus.NewCounter(
+// make... - без регистрации, см. registerOrReuse
+
+func makeCounter(ns, name, method string) prometheus.Counter {
+	return prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Namespace: ns,
 			//Subsystem: serviceName,
 			Name:        name,
-			ConstLabels: labels,
+			ConstLabels: methodLabels(method),
 		})
-	prometheus.MustRegister(c)
-	return c
 }
 
-func newGauge(ns, name, method string) prometheus.Gauge {
-
-	var labels prometheus.Labels
-	if method != "" {
-		labels = map[string]string{
-			"method": method,
-		}
-	}
-
-	g := prometheus.NewGauge(
+func makeGauge(ns, name, method string) prometheus.Gauge {
+	return prometheus.NewGauge(
 		prometheus.GaugeOpts{
 			Namespace: ns,
 			//Subsystem: serviceName,
 			Name:        name,
-			ConstLabels: labels,
+			ConstLabels: methodLabels(method),
 		})
-	prometheus.MustRegister(g)
-	return g
 }
 
-func newSummary(ns, name, method string) prometheus.Summary {
-
-	var labels prometheus.Labels
-	if method != "" {
-		labels = map[string]string{
-			"method": method,
-		}
-	}
-
-	s := prometheus.NewSummary(
+func makeSummary(ns, name, method string) prometheus.Summary {
+	return prometheus.NewSummary(
 		prometheus.SummaryOpts{
 			Namespace: ns,
 			//Subsystem: serviceName,
 			Name:        name,
-			ConstLabels: labels,
+			ConstLabels: methodLabels(method),
 		})
-	prometheus.MustRegister(s)
-	return s
+}
+
+/*
+	Регистрирует c, а если такая же метрика уже зарегистрирована - возвращает ее вместо c.
+	Если c зарегистрирован, он добавляется в registered, чтобы регистрацию можно было отменить.
+*/
+func registerOrReuse(c prometheus.Collector, registered *[]prometheus.Collector) prometheus.Collector {
+	if err := prometheus.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector
+		}
+		panic(err)
+	}
+	*registered = append(*registered, c)
+	return c
 }
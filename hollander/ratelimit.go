@@ -0,0 +1,126 @@
+package hollander
+
+import (
+	"fmt"
+	"github.com/happywbfriends/nano/xerror"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type RateLimitAlgorithm int
+
+const (
+	// Допускает всплеск до Requests запросов, дальше - равномерно Requests за Period
+	TokenBucket RateLimitAlgorithm = iota
+	// Не больше Requests запросов за любой отрезок длиной Period (приближенно)
+	SlidingWindow
+)
+
+type RateLimit struct {
+	Algorithm RateLimitAlgorithm
+	Requests  int
+	Period    time.Duration
+}
+
+// Результат проверки лимита для одного запроса
+type RateLimitDecision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int           // сколько запросов еще можно сделать сразу
+	Reset      time.Duration // через сколько лимит полностью восстановится
+	RetryAfter time.Duration // если !Allowed - через сколько можно повторить
+}
+
+const (
+	HeaderRetryAfter         = "Retry-After"
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+)
+
+/*
+	Ограничение частоты запросов от одного клиента, HttpHandler для Middleware:
+
+	limiter := NewRateLimiter(RateLimit{Algorithm: TokenBucket, Requests: 100, Period: time.Minute}).WithKey(KeyByHeader("X-Api-Key"))
+	router.Group("/api").Use(limiter.Handle)
+
+	Превысившему лимит клиенту отвечает 429 с Retry-After, всем - заголовки RateLimit-*.
+	Отказы считаются в HTTPMetrics.NbRateLimited. Если хранилище недоступно, запрос пропускается.
+	Разные RateLimiter с общим хранилищем должны использовать разные ключи (см. WithKey).
+*/
+type RateLimiter struct {
+	limit RateLimit
+	key   func(r *http.Request) string
+	store IRateLimitStore
+}
+
+// По умолчанию ключ - IP клиента, хранилище - в памяти с ограничением в миллион ключей
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+	if limit.Requests <= 0 || limit.Period <= 0 {
+		panic(fmt.Sprintf("invalid rate limit %d per %s", limit.Requests, limit.Period))
+	}
+	return &RateLimiter{
+		limit: limit,
+		key:   KeyByIP,
+		store: NewMemoryRateLimitStore(1000000),
+	}
+}
+
+// Ключ клиента. Если функция вернула пустую строку, используется IP
+func (l *RateLimiter) WithKey(key func(r *http.Request) string) *RateLimiter {
+	l.key = key
+	return l
+}
+
+func (l *RateLimiter) WithStore(store IRateLimitStore) *RateLimiter {
+	l.store = store
+	return l
+}
+
+// IP из RemoteAddr, без порта. Заголовкам прокси (X-Forwarded-For) не доверяем: их может подделать клиент
+func KeyByIP(r *http.Request) string {
+	return stripPort(r.RemoteAddr)
+}
+
+// Значение заголовка, например API-ключа
+func KeyByHeader(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// Ошибка 429, по ней Middleware считает отказы в метриках
+type _RateLimitedError struct {
+	xerror.IError
+}
+
+var errRateLimited = &_RateLimitedError{xerror.NewCustom(http.StatusTooManyRequests, 0, "Too many requests")}
+
+func (l *RateLimiter) Handle(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+	key := l.key(r)
+	if key == "" {
+		key = KeyByIP(r)
+	}
+
+	d, err := l.store.Allow(key, l.limit, time.Now())
+	if err != nil {
+		mw.Log().Warnf("rate limit store: %s", err)
+		return true, nil
+	}
+
+	mw.SetHeader(HeaderRateLimitLimit, strconv.Itoa(d.Limit))
+	mw.SetHeader(HeaderRateLimitRemaining, strconv.Itoa(d.Remaining))
+	mw.SetHeader(HeaderRateLimitReset, seconds(d.Reset))
+	if !d.Allowed {
+		mw.SetHeader(HeaderRetryAfter, seconds(d.RetryAfter))
+		return false, errRateLimited
+	}
+	return true, nil
+}
+
+// Целое число секунд с округлением вверх, как требуют Retry-After и RateLimit-Reset
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,172 @@
+package hollander
+
+import (
+	"hash/maphash"
+	"math"
+	"sync"
+	"time"
+)
+
+/*
+	Хранилище состояний лимитов. Алгоритм реализует само хранилище, чтобы общие хранилища (Redis и т.п.)
+	могли делать проверку и обновление атомарно на своей стороне.
+*/
+type IRateLimitStore interface {
+	Allow(key string, limit RateLimit, now time.Time) (RateLimitDecision, error)
+}
+
+const (
+	rateLimitShards     = 32
+	rateLimitSweepEvery = 1024 // операций над шардом между чистками
+)
+
+/*
+	Хранилище в памяти процесса: ключи разбиты на шарды со своими мьютексами.
+	Состояние ключа удаляется, когда лимит по нему полностью восстановился (чистка раз в rateLimitSweepEvery операций),
+	а при превышении maxKeys на шард новый ключ вытесняет произвольный.
+*/
+type MemoryRateLimitStore struct {
+	seed    maphash.Seed
+	maxKeys int // на шард
+	shards  [rateLimitShards]_RateLimitShard
+}
+
+type _RateLimitShard struct {
+	mu    sync.Mutex
+	items map[string]*_RateLimitState
+	ops   int
+}
+
+type _RateLimitState struct {
+	// TokenBucket: tokens и время их подсчета
+	// SlidingWindow: tokens - число запросов в текущем окне, prev - в предыдущем, at - начало текущего окна
+	tokens  float64
+	prev    float64
+	at      time.Time
+	expires time.Time // после этого состояние неотличимо от нового
+}
+
+// maxKeys - ограничение на число ключей в памяти, 0 - без ограничения
+func NewMemoryRateLimitStore(maxKeys int) *MemoryRateLimitStore {
+	s := &MemoryRateLimitStore{seed: maphash.MakeSeed()}
+	if maxKeys > 0 {
+		s.maxKeys = maxKeys/rateLimitShards + 1
+	}
+	for i := range s.shards {
+		s.shards[i].items = make(map[string]*_RateLimitState)
+	}
+	return s
+}
+
+func (s *MemoryRateLimitStore) Allow(key string, limit RateLimit, now time.Time) (RateLimitDecision, error) {
+	var h maphash.Hash
+	h.SetSeed(s.seed)
+	_, _ = h.WriteString(key)
+	shard := &s.shards[h.Sum64()%rateLimitShards]
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.ops++
+	if shard.ops%rateLimitSweepEvery == 0 {
+		shard.sweep(now)
+	}
+
+	st := shard.items[key]
+	if st == nil {
+		if s.maxKeys > 0 && len(shard.items) >= s.maxKeys {
+			// один произвольный ключ, без полного обхода: клиент, перебирающий ключи, не должен
+			// заставлять чистить весь шард на каждый запрос. Истекшие ключи уберет очередная чистка
+			for k := range shard.items {
+				delete(shard.items, k)
+				break
+			}
+		}
+		st = newRateLimitState(limit, now)
+		shard.items[key] = st
+	}
+
+	if limit.Algorithm == SlidingWindow {
+		return st.slidingWindow(limit, now), nil
+	}
+	return st.tokenBucket(limit, now), nil
+}
+
+func (sh *_RateLimitShard) sweep(now time.Time) {
+	for k, st := range sh.items {
+		if now.After(st.expires) {
+			delete(sh.items, k)
+		}
+	}
+}
+
+func newRateLimitState(limit RateLimit, now time.Time) *_RateLimitState {
+	if limit.Algorithm == SlidingWindow {
+		return &_RateLimitState{at: now}
+	}
+	return &_RateLimitState{tokens: float64(limit.Requests), at: now}
+}
+
+// Ведро емкостью Requests, пополняется равномерно на Requests за Period
+func (st *_RateLimitState) tokenBucket(limit RateLimit, now time.Time) RateLimitDecision {
+	capacity := float64(limit.Requests)
+	perToken := limit.Period / time.Duration(limit.Requests)
+
+	if elapsed := now.Sub(st.at); elapsed > 0 {
+		st.tokens = math.Min(capacity, st.tokens+float64(elapsed)/float64(perToken))
+		st.at = now
+	}
+
+	d := RateLimitDecision{Limit: limit.Requests}
+	if st.tokens >= 1 {
+		st.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = time.Duration((1 - st.tokens) * float64(perToken))
+	}
+	d.Remaining = int(st.tokens)
+	d.Reset = time.Duration((capacity - st.tokens) * float64(perToken))
+	st.expires = now.Add(d.Reset)
+	return d
+}
+
+/*
+	Скользящее окно, приближенное двумя фиксированными окнами: число запросов за последний Period
+	оценивается как prev * (доля предыдущего окна, попадающая в Period) + tokens.
+*/
+func (st *_RateLimitState) slidingWindow(limit RateLimit, now time.Time) RateLimitDecision {
+	period := limit.Period
+	capacity := float64(limit.Requests)
+
+	// сдвигаем окна
+	if elapsed := now.Sub(st.at); elapsed >= 2*period {
+		st.prev, st.tokens = 0, 0
+		st.at = now.Add(-elapsed % period)
+	} else if elapsed >= period {
+		st.prev, st.tokens = st.tokens, 0
+		st.at = st.at.Add(period)
+	}
+	elapsed := now.Sub(st.at)
+	weight := 1 - float64(elapsed)/float64(period)
+
+	d := RateLimitDecision{Limit: limit.Requests, Reset: period - elapsed}
+	if st.prev*weight+st.tokens+1 <= capacity {
+		st.tokens++
+		d.Allowed = true
+	} else if st.tokens+1 <= capacity {
+		// хватит, когда вклад предыдущего окна уменьшится: prev * (1 - (elapsed+t)/period) + tokens + 1 <= Requests
+		d.RetryAfter = time.Duration((1-(capacity-1-st.tokens)/st.prev)*float64(period)) - elapsed
+	} else {
+		// только в следующем окне, где текущее станет предыдущим
+		d.RetryAfter = period - elapsed + time.Duration((1-(capacity-1)/st.tokens)*float64(period))
+	}
+	if d.RetryAfter < 0 {
+		d.RetryAfter = 0
+	}
+	d.Remaining = int(capacity - st.prev*weight - st.tokens)
+	if d.Remaining < 0 {
+		d.Remaining = 0
+	}
+	st.expires = st.at.Add(2 * period)
+	return d
+}
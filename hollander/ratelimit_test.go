@@ -0,0 +1,167 @@
+package hollander
+
+import (
+	"fmt"
+	"github.com/happywbfriends/nano/logger"
+	"github.com/happywbfriends/nano/xerror"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"hash/maphash"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	store := NewMemoryRateLimitStore(0)
+	limit := RateLimit{Algorithm: TokenBucket, Requests: 3, Period: 3 * time.Second}
+	now := time.Unix(1000, 0)
+
+	steps := []struct {
+		after      time.Duration
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}{
+		{0, true, 2, 0},
+		{0, true, 1, 0},
+		{0, true, 0, 0},
+		{0, false, 0, time.Second}, // всплеск исчерпан
+		{500 * time.Millisecond, false, 0, 500 * time.Millisecond},
+		{500 * time.Millisecond, true, 0, 0}, // накопился один токен
+		{10 * time.Second, true, 2, 0},       // больше емкости не накапливается
+	}
+	for i, s := range steps {
+		now = now.Add(s.after)
+		d, _ := store.Allow("k", limit, now)
+		if d.Allowed != s.allowed || d.Remaining != s.remaining || d.RetryAfter != s.retryAfter || d.Limit != 3 {
+			t.Errorf("step %d: got %+v", i, d)
+		}
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	store := NewMemoryRateLimitStore(0)
+	limit := RateLimit{Algorithm: SlidingWindow, Requests: 4, Period: 10 * time.Second}
+	now := time.Unix(1000, 0)
+
+	allow := func(after time.Duration) RateLimitDecision {
+		now = now.Add(after)
+		d, _ := store.Allow("k", limit, now)
+		return d
+	}
+
+	for i := 0; i < 4; i++ {
+		if d := allow(time.Second); !d.Allowed {
+			t.Fatalf("request %d rejected: %+v", i, d)
+		}
+	}
+	// 4 запроса в окне [1000, 1010)
+	// освободится в следующем окне, когда 4 * (1 - t/10) + 1 <= 4: 7с до его начала + 2.5с
+	d := allow(0)
+	if d.Allowed || d.RetryAfter != 9500*time.Millisecond {
+		t.Fatalf("got %+v", d)
+	}
+	// окна начинаются с 1001; в следующем вклад предыдущего 4 * 0.9 = 3.6, свободного места нет
+	if d = allow(8 * time.Second); d.Allowed {
+		t.Fatalf("expected rejection at 1012: %+v", d)
+	}
+	// 4 * 0.35 = 1.4, запрос проходит, остается int(4 - 1.4 - 1) = 1
+	if d = allow(5500 * time.Millisecond); !d.Allowed || d.Remaining != 1 {
+		t.Fatalf("expected allowance at 1017.5: %+v", d)
+	}
+	// спустя два окна все забыто
+	if d = allow(time.Minute); !d.Allowed || d.Remaining != 3 {
+		t.Fatalf("got %+v", d)
+	}
+}
+
+func TestMemoryRateLimitStore_Eviction(t *testing.T) {
+	store := NewMemoryRateLimitStore(rateLimitShards * 4)
+	limit := RateLimit{Requests: 1, Period: time.Hour}
+	now := time.Now()
+	for i := 0; i < 10000; i++ {
+		_, _ = store.Allow(fmt.Sprint(i), limit, now)
+	}
+	total := 0
+	for i := range store.shards {
+		total += len(store.shards[i].items)
+	}
+	if total > rateLimitShards*5 {
+		t.Errorf("store keeps %d keys", total)
+	}
+
+	// в заполненном шарде новый ключ вытесняет ровно один, даже если остальные уже истекли: без полного обхода
+	sh := &store.shards[0]
+	full := len(sh.items)
+	for i := 0; ; i++ {
+		key := fmt.Sprint("later", i)
+		var h maphash.Hash
+		h.SetSeed(store.seed)
+		_, _ = h.WriteString(key)
+		if h.Sum64()%rateLimitShards == 0 {
+			_, _ = store.Allow(key, limit, now.Add(2*time.Hour))
+			break
+		}
+	}
+	if len(sh.items) != full {
+		t.Errorf("shard went from %d to %d keys on a single insert", full, len(sh.items))
+	}
+
+	// восстановившиеся ключи вычищаются
+	store = NewMemoryRateLimitStore(0)
+	for i := 0; i < rateLimitShards*rateLimitSweepEvery; i++ {
+		_, _ = store.Allow(fmt.Sprint(i%100), RateLimit{Requests: 10, Period: time.Second}, now)
+	}
+	now = now.Add(2 * time.Second)
+	for i := 0; i < 2*rateLimitShards*rateLimitSweepEvery; i++ {
+		_, _ = store.Allow(fmt.Sprint("new", i%1000), RateLimit{Requests: 10, Period: time.Second}, now)
+	}
+	for i := 0; i < 100; i++ {
+		for j := range store.shards {
+			if _, found := store.shards[j].items[fmt.Sprint(i)]; found {
+				t.Fatalf("expired key %d is not swept", i)
+			}
+		}
+	}
+}
+
+func TestRateLimiter_Handle(t *testing.T) {
+	limiter := NewRateLimiter(RateLimit{Algorithm: TokenBucket, Requests: 2, Period: time.Minute}).WithKey(KeyByHeader("X-Api-Key"))
+	mw := NewMiddleware(logger.NoLogger).WithMetrics("test_ratelimit", "GET /").Use(limiter.Handle).
+		Use(func(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+			mw.SendText(http.StatusOK, "ok")
+			return false, nil
+		})
+
+	serve := func(apiKey string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if apiKey != "" {
+			r.Header.Set("X-Api-Key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		mw.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := serve("a"); w.Code != http.StatusOK || w.Header().Get(HeaderRateLimitRemaining) != fmt.Sprint(1-i) {
+			t.Fatalf("request %d: got status %d, headers %v", i, w.Code, w.Header())
+		}
+	}
+	w := serve("a")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get(HeaderRetryAfter) != "30" || w.Header().Get(HeaderRateLimitLimit) != "2" {
+		t.Errorf("got status %d, headers %v", w.Code, w.Header())
+	}
+	// другой ключ и запрос без ключа (по IP) - свои лимиты
+	if w := serve("b"); w.Code != http.StatusOK {
+		t.Errorf("key b: got status %d", w.Code)
+	}
+	if w := serve(""); w.Code != http.StatusOK {
+		t.Errorf("no key: got status %d", w.Code)
+	}
+
+	if n := testutil.ToFloat64(mw.metrics.NbRateLimited); n != 1 {
+		t.Errorf("got %v rejections in metrics, want 1", n)
+	}
+}
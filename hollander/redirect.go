@@ -0,0 +1,121 @@
+package hollander
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+/*
+	Исправление тривиальных ошибок в пути. Если роут для пути не найден, но найден для исправленного,
+	клиент получает редирект: 301 для GET и HEAD, 308 для остальных методов (сохраняет метод и тело).
+	Все исправления выключены по умолчанию, см. поля NanoRouter.
+*/
+
+// Канонический путь, на который надо перенаправить запрос, или "", если такого нет
+func (router *NanoRouter) fixPath(t *_RouteTable, p string) string {
+	if !router.RedirectCleanPath && !router.RedirectTrailingSlash && !router.RedirectCaseInsensitive {
+		return ""
+	}
+
+	candidates := make([]string, 0, 2)
+	if router.RedirectCleanPath {
+		candidates = append(candidates, cleanPath(p))
+	} else {
+		candidates = append(candidates, p)
+	}
+	if router.RedirectTrailingSlash {
+		candidates = append(candidates, toggleTrailingSlash(candidates[0]))
+	}
+
+	for _, c := range candidates {
+		if c != p && t.exists(c) {
+			return c
+		}
+	}
+
+	if router.RedirectCaseInsensitive {
+		for _, c := range candidates {
+			if fixed, ok := t.findFold(c); ok && fixed != p {
+				return fixed
+			}
+		}
+	}
+
+	return ""
+}
+
+func (t *_RouteTable) exists(p string) bool {
+	var buf [maxInlineParams]Param
+	rt, _ := t.find(p, buf[:0])
+	return rt != nil
+}
+
+/*
+	Ищет роут без учета регистра и возвращает путь с регистром из шаблона (значения параметров не меняются).
+	Если статических шаблонов, отличающихся только регистром, несколько, предпочитается точное совпадение,
+	иначе - наименьший шаблон, чтобы редирект не зависел от порядка обхода map.
+*/
+func (t *_RouteTable) findFold(p string) (string, bool) {
+	if _, ok := t.staticRoutes[p]; ok {
+		return p, true
+	}
+	best, found := "", false
+	for template := range t.staticRoutes {
+		if strings.EqualFold(template, p) && (!found || template < best) {
+			best, found = template, true
+		}
+	}
+	if found {
+		return best, true
+	}
+	if t.paramRoutes != nil {
+		if fixed, ok := t.paramRoutes.lookupFold(p, make([]byte, 0, len(p))); ok {
+			return string(fixed), true
+		}
+	}
+	return "", false
+}
+
+func (router *NanoRouter) redirect(w http.ResponseWriter, r *http.Request, fixed string, up *_Mounted) {
+	// смонтированный роутер видит путь без префиксов, а редирект должен быть на полный путь
+	for m := up; m != nil; m = m.up {
+		fixed = m.prefix + fixed
+	}
+	// защита от протокол-относительного URL (//evil.com), который браузер воспримет как другой хост
+	if strings.HasPrefix(fixed, "//") {
+		router.notFound(w, r, up)
+		return
+	}
+
+	code := http.StatusPermanentRedirect
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		code = http.StatusMovedPermanently
+	}
+
+	location := (&url.URL{Path: fixed, RawQuery: r.URL.RawQuery}).String()
+	http.Redirect(w, r, location, code)
+}
+
+// Как path.Clean, но сохраняет слэш в конце
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	cleaned := path.Clean("/" + p)
+	if p[len(p)-1] == '/' && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+func toggleTrailingSlash(p string) string {
+	if p == "/" {
+		return p
+	}
+	if strings.HasSuffix(p, "/") {
+		return p[:len(p)-1]
+	}
+	return p + "/"
+}
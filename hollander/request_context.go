@@ -7,6 +7,7 @@ import (
 	"github.com/happywbfriends/nano/xerror"
 	"io"
 	"net/http"
+	"time"
 )
 
 type IMiddleware interface {
@@ -14,9 +15,24 @@ type IMiddleware interface {
 	Context() context.Context
 	Log() logger.ILogger
 	RequestId() string
+	// Path-параметры, найденные NanoRouter
+	PathParams() Params
+	PathParam(name string) string
+	PathParamInt(name string) (int, xerror.IError)
 	ReadJSONBody(dest interface{}) xerror.IError
+	// Тип ответа по заголовку Accept, см. Negotiate
+	Negotiate(offers ...string) (string, xerror.IError)
 	SetHeader(name, value string)
+	// Обертка над исходным writer, см. _ResponseWriter: поддерживает Flusher, Hijacker, ReaderFrom
 	Writer() http.ResponseWriter
+	// Заголовки ответа уже отправлены: менять статус и заголовки поздно
+	HeadersSent() bool
+	// Отправленный статус, 0 если заголовки еще не отправлены
+	ResponseStatus() int
+	// Сколько байт тела ответа уже записано
+	BytesWritten() int64
+	// Время от начала обработки запроса до отправки заголовков, 0 если они еще не отправлены
+	TimeToFirstByte() time.Duration
 	// Все Send... методы не возвращают никаких ошибок, поскольку предполагается, что отправка ответа - это последний
 	// этап обработки любого запроса, и в случае проблем с записью ответа пользовательский код все равно не может
 	// ничего сделать кроме как отписаться в логи, что данные методы и делают за него.
@@ -27,7 +43,7 @@ type IMiddleware interface {
 
 type _RequestContext struct {
 	log       logger.ILogger
-	w         *responseStatusInterceptor
+	w         *_ResponseWriter
 	r         *http.Request
 	vals      Values
 	requestId string
@@ -49,6 +65,22 @@ func (m *_RequestContext) RequestId() string {
 	return m.requestId
 }
 
+func (m *_RequestContext) PathParams() Params {
+	return PathParams(m.r)
+}
+
+func (m *_RequestContext) PathParam(name string) string {
+	return PathParam(m.r, name)
+}
+
+func (m *_RequestContext) PathParamInt(name string) (int, xerror.IError) {
+	return PathParamInt(m.r, name)
+}
+
+func (m *_RequestContext) Negotiate(offers ...string) (string, xerror.IError) {
+	return Negotiate(m.r, offers...)
+}
+
 func (m *_RequestContext) SetHeader(name, value string) {
 	m.w.Header().Set(name, value)
 }
@@ -57,6 +89,22 @@ func (m *_RequestContext) Writer() http.ResponseWriter {
 	return m.w
 }
 
+func (m *_RequestContext) HeadersSent() bool {
+	return m.w.headersSent
+}
+
+func (m *_RequestContext) ResponseStatus() int {
+	return m.w.status
+}
+
+func (m *_RequestContext) BytesWritten() int64 {
+	return m.w.bytes
+}
+
+func (m *_RequestContext) TimeToFirstByte() time.Duration {
+	return m.w.ttfb
+}
+
 func (m *_RequestContext) Send(status int, contentType string, dataOpt []byte) {
 	if contentType != "" {
 		m.w.Header().Set(HeaderContentType, contentType)
@@ -88,7 +136,7 @@ func (m *_RequestContext) SendJSON(status int, obj interface{}) {
 var unsupportedContentType = xerror.NewCustom(http.StatusUnsupportedMediaType, 0, "Invalid Content-Type. Expected 'application/json'")
 
 func (m *_RequestContext) ReadJSONBody(dest interface{}) xerror.IError {
-	if m.r.Header.Get(HeaderContentType) != ContentTypeJSON {
+	if requestMediaType(m.r) != ContentTypeJSON {
 		return unsupportedContentType
 	}
 
@@ -0,0 +1,126 @@
+package hollander
+
+import (
+	"bufio"
+	"github.com/happywbfriends/nano/logger"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+/*
+	Обертка над http.ResponseWriter, которую Middleware передает хендлерам.
+	Запоминает статус, число байт тела и время до отправки заголовков (TTFB), следит за тем, отправлены ли уже заголовки.
+
+	Всегда реализует http.Flusher, http.Hijacker, http.Pusher и io.ReaderFrom, даже если исходный writer их не поддерживает:
+	тогда Flush ничего не делает, ReadFrom копирует через Write, а Hijack и Push возвращают http.ErrNotSupported.
+	Unwrap позволяет http.ResponseController добраться до исходного writer.
+*/
+type _ResponseWriter struct {
+	w           http.ResponseWriter
+	log         logger.ILogger
+	start       time.Time
+	status      int           // 0, пока заголовки не отправлены
+	headersSent bool          // после этого статус и заголовки менять поздно
+	hijacked    bool          // соединение забрал хендлер (websocket и т.п.)
+	bytes       int64         // записано байт тела
+	ttfb        time.Duration // от создания до отправки заголовков
+}
+
+func newResponseWriter(w http.ResponseWriter, log logger.ILogger) *_ResponseWriter {
+	return &_ResponseWriter{w: w, log: log, start: time.Now()}
+}
+
+func (rw *_ResponseWriter) Header() http.Header {
+	return rw.w.Header()
+}
+
+func (rw *_ResponseWriter) WriteHeader(code int) {
+	if rw.headersSent {
+		// net/http только напишет "superfluous WriteHeader call" без контекста запроса
+		rw.log.Warnf("WriteHeader(%d) called after headers were sent with status %d, ignored", code, rw.status)
+		return
+	}
+	// информационные ответы (103 Early Hints) можно отправлять несколько раз до основного
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		rw.w.WriteHeader(code)
+		return
+	}
+	rw.sent(code)
+	rw.w.WriteHeader(code)
+}
+
+func (rw *_ResponseWriter) sent(code int) {
+	rw.status = code
+	rw.headersSent = true
+	rw.ttfb = time.Since(rw.start)
+}
+
+func (rw *_ResponseWriter) Write(b []byte) (int, error) {
+	if !rw.headersSent {
+		rw.WriteHeader(http.StatusOK)
+	}
+	n, err := rw.w.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+func (rw *_ResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !rw.headersSent {
+		rw.WriteHeader(http.StatusOK)
+	}
+	var n int64
+	var err error
+	if rf, ok := rw.w.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		// без обертки io.Copy снова нашел бы наш ReadFrom
+		n, err = io.Copy(struct{ io.Writer }{rw.w}, src)
+	}
+	rw.bytes += n
+	return n, err
+}
+
+func (rw *_ResponseWriter) Flush() {
+	if !rw.headersSent {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := rw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rw *_ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, buf, err := h.Hijack()
+	if err == nil {
+		rw.hijacked = true
+		if !rw.headersSent {
+			rw.sent(http.StatusSwitchingProtocols)
+		}
+	}
+	return conn, buf, err
+}
+
+func (rw *_ResponseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := rw.w.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+func (rw *_ResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.w
+}
+
+// Статус, который получит (или получил) клиент: если хендлер ничего не записал, net/http отдаст 200
+func (rw *_ResponseWriter) effectiveStatus() int {
+	if rw.status == 0 {
+		return http.StatusOK
+	}
+	return rw.status
+}
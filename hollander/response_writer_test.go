@@ -0,0 +1,109 @@
+package hollander
+
+import (
+	"bufio"
+	"github.com/happywbfriends/nano/logger"
+	"github.com/happywbfriends/nano/xerror"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseWriter_State(t *testing.T) {
+	log := newTestLogger()
+	var before, after [3]interface{}
+	mw := NewMiddleware(log).Use(func(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+		before = [3]interface{}{mw.HeadersSent(), mw.ResponseStatus(), mw.BytesWritten()}
+		_, _ = mw.Writer().Write([]byte("hello"))  // неявный 200
+		mw.Writer().WriteHeader(http.StatusTeapot) // игнорируется
+		after = [3]interface{}{mw.HeadersSent(), mw.ResponseStatus(), mw.BytesWritten()}
+		if mw.TimeToFirstByte() <= 0 {
+			t.Errorf("TTFB is not recorded")
+		}
+		// заголовки ушли - ошибка только логируется
+		return false, xerror.NewBadRequest("too late")
+	})
+
+	w := httptest.NewRecorder()
+	mw.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if before != [3]interface{}{false, 0, int64(0)} || after != [3]interface{}{true, http.StatusOK, int64(5)} {
+		t.Errorf("got state before %v, after %v", before, after)
+	}
+	if w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Errorf("got status %d, body '%s'", w.Code, w.Body.String())
+	}
+	lines := log.Lines()
+	if len(lines) != 2 || !strings.Contains(lines[0], "WriteHeader(418)") || !strings.Contains(lines[1], "too late") {
+		t.Errorf("got log %q", lines)
+	}
+}
+
+func TestResponseWriter_OptionalInterfaces(t *testing.T) {
+	mw := NewMiddleware(logger.NoLogger).Use(func(r *http.Request, mw IMiddleware) (proceed bool, e xerror.IError) {
+		w := mw.Writer()
+		switch r.URL.Path {
+		case "/stream":
+			_, _ = w.Write([]byte("chunk"))
+			w.(http.Flusher).Flush()
+		case "/copy":
+			_, _ = w.(io.ReaderFrom).ReadFrom(strings.NewReader("copied"))
+		case "/upgrade":
+			conn, buf, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				return false, xerror.WrapFailure(err)
+			}
+			defer func() { _ = conn.Close() }()
+			_, _ = buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: test\r\nConnection: Upgrade\r\n\r\nraw")
+			_ = buf.Flush()
+			if mw.ResponseStatus() != http.StatusSwitchingProtocols {
+				t.Errorf("got status %d after hijack", mw.ResponseStatus())
+			}
+		}
+		return false, nil
+	})
+
+	// ResponseRecorder умеет Flush, но не Hijack
+	w := httptest.NewRecorder()
+	mw.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	if !w.Flushed || w.Body.String() != "chunk" {
+		t.Errorf("flush: flushed %v, body '%s'", w.Flushed, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	mw.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/copy", nil))
+	if w.Body.String() != "copied" {
+		t.Errorf("ReadFrom: got body '%s'", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	mw.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/upgrade", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("hijack on recorder: got status %d, want 500", w.Code)
+	}
+
+	srv := httptest.NewServer(mw)
+	defer srv.Close()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_, _ = conn.Write([]byte("GET /upgrade HTTP/1.1\r\nHost: x\r\n\r\n"))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("hijack: got status %d", resp.StatusCode)
+	}
+
+	// ResponseController видит исходный writer через Unwrap
+	var rw http.ResponseWriter = newResponseWriter(httptest.NewRecorder(), logger.NoLogger)
+	if _, ok := rw.(interface{ Unwrap() http.ResponseWriter }); !ok {
+		t.Errorf("Unwrap is not implemented")
+	}
+}
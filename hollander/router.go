@@ -1,20 +1,29 @@
 package hollander
 
 import (
-	"context"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
+// Сколько параметров помещается в буфер на стеке без аллокаций
+const maxInlineParams = 8
+
 type _Route struct {
-	paramName string // используется только в param-routes
-	get       http.Handler
-	post      http.Handler
-	put       http.Handler
-	delete    http.Handler
-	patch     http.Handler
-	options   http.Handler
+	template string // шаблон, с которым роут был зарегистрирован
+	get      http.Handler
+	post     http.Handler
+	put      http.Handler
+	delete   http.Handler
+	patch    http.Handler
+	options  http.Handler
+	head     http.Handler
+	other    map[string]http.Handler // нестандартные методы (PROPFIND, QUERY, ...), nullable
+	allow    []string                // значение заголовка Allow (один элемент), пересчитывается при каждом set
+	mount    *_Mount                 // если задан, роут обслуживает смонтированный хендлер для любого метода, nullable
 }
 
 func (rt *_Route) ptr(method string) *http.Handler {
@@ -31,125 +40,386 @@ func (rt *_Route) ptr(method string) *http.Handler {
 		return &rt.patch
 	case http.MethodOptions:
 		return &rt.options
+	case http.MethodHead:
+		return &rt.head
 	default:
 		return nil
 	}
 }
 
-func isMethodSupported(method string) bool {
-	var rt _Route
-	return rt.ptr(method) != nil
+func (rt *_Route) handler(method string) http.Handler {
+	if m := rt.ptr(method); m != nil {
+		return *m
+	}
+	return rt.other[method]
+}
+
+// h == nil удаляет хендлер
+func (rt *_Route) set(method string, h http.Handler) {
+	if m := rt.ptr(method); m != nil {
+		*m = h
+	} else if h == nil {
+		delete(rt.other, method)
+	} else {
+		if rt.other == nil {
+			rt.other = make(map[string]http.Handler)
+		}
+		rt.other[method] = h
+	}
+	// готовый слайс, чтобы не аллоцировать его в Header().Set на каждый ответ 405/OPTIONS
+	rt.allow = []string{strings.Join(rt.methods(), ", ")}
+}
+
+// Явно зарегистрированные методы в алфавитном порядке
+func (rt *_Route) registeredMethods() []string {
+	var methods []string
+	for _, m := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodPatch, http.MethodOptions, http.MethodHead} {
+		if *rt.ptr(m) != nil {
+			methods = append(methods, m)
+		}
+	}
+	for m := range rt.other {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Методы, на которые роут ответит не 405, в алфавитном порядке.
+// HEAD обслуживается GET-хендлером, OPTIONS отвечается автоматически.
+func (rt *_Route) methods() []string {
+	methods := rt.registeredMethods()
+	if rt.options == nil {
+		methods = append(methods, http.MethodOptions)
+	}
+	if rt.head == nil && rt.get != nil {
+		methods = append(methods, http.MethodHead)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Метод - это token по RFC 9110
+func isValidMethod(method string) bool {
+	if method == "" {
+		return false
+	}
+	for i := 0; i < len(method); i++ {
+		c := method[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("!#$%&'*+-.^_`|~", c) != -1) {
+			return false
+		}
+	}
+	return true
 }
 
 /*
-	NanoRouter is thread-unsafe. After starting http listen no changes are allowed
+	Роуты можно добавлять, заменять и удалять (Handle, Replace, Remove, Mount) в любой момент, в т.ч. под нагрузкой:
+	таблица роутов copy-on-write, поиск идет без блокировок. Публичные поля (NotFound, Redirect...)
+	потокобезопасными не являются и должны быть заданы до начала обслуживания запросов.
+
+	Поддерживаются любые методы, в т.ч. нестандартные (PROPFIND, QUERY, ...).
+	HEAD без явного хендлера обслуживается GET-хендлером с отбрасыванием тела,
+	OPTIONS без явного хендлера отвечает 204 с заголовком Allow, 405 также всегда отдается с Allow.
+
+	Шаблоны путей:
+		/a/b/c				статический
+		/orders/:id			параметр, занимает целый сегмент
+		/orders/:id<int>	параметр с ограничением: int, uuid или регулярное выражение
+		/files/*path		catch-all, только последним сегментом, захватывает остаток пути со слэшами
+	Приоритет при совпадении: статика > :param<constraint> > :param > *catchAll
+
+	Один путь и метод может обслуживаться разными хендлерами в зависимости от хоста, заголовка
+	или произвольного условия, см. HandleIf.
 */
 type NanoRouter struct {
-	staticRoutes     map[string]*_Route // полностью статичные роуты
-	paramRoutes      map[string]*_Route // роуты с поддержкой одного path param, nullable
-	NotFound         http.Handler       // если роут не найден
-	MethodNotAllowed http.Handler       // если роут найден, но не поддерживает указанный метод
+	table                atomic.Value // *_RouteTable, см. table.go
+	mu                   sync.Mutex   // сериализует изменения table
+	NotFound             http.Handler // если роут не найден
+	MethodNotAllowed     http.Handler // если роут найден, но не поддерживает указанный метод
+	UnsupportedMediaType http.Handler // если у роута есть варианты для Content-Type (Consumes), но не для этого
+
+	// Если роут не найден, пробовать исправить путь и перенаправить клиента, см. fixPath
+	RedirectTrailingSlash   bool // /orders/ <-> /orders
+	RedirectCleanPath       bool // /a//b/../c -> /a/c
+	RedirectCaseInsensitive bool // /ORDERS -> /orders
+
+	// Паниковать при регистрации роута, если он участвует в проблемах, которые находит Validate
+	Strict bool
+
+	/*
+		Брать запросы с path-параметрами из пула: тогда на запрос с параметрами нет ни одной аллокации,
+		но ни сам *http.Request, ни его контекст нельзя использовать после возврата из хендлера -
+		ни в запущенной им горутине, ни через http.TimeoutHandler, который продолжает работу хендлера в своей горутине.
+		Без пула - одна аллокация на запрос с параметрами, и запрос живет, сколько нужно.
+	*/
+	PoolRequests bool
+
+	// Если задан, отвечает на CORS preflight для всех роутов, в т.ч. смонтированных роутеров. nullable
+	CORS *CORS
+
+	// Если задан, забаненным клиентам отвечает до поиска роута, а 404/405/415 роутера засчитываются в бан. nullable
+	Banner *Banner
 }
 
 func NewRouter() *NanoRouter {
-	return &NanoRouter{
-		staticRoutes:     make(map[string]*_Route),
-		paramRoutes:      nil,
-		NotFound:         &defaultNotFoundHandler,
-		MethodNotAllowed: &defaultMethodNotAllowedHandler,
+	router := &NanoRouter{
+		NotFound:             &defaultNotFoundHandler,
+		MethodNotAllowed:     &defaultMethodNotAllowedHandler,
+		UnsupportedMediaType: &defaultUnsupportedMediaTypeHandler,
 	}
+	router.table.Store(newRouteTable())
+	return router
 }
 
 func (router *NanoRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// сперва ищем статический роут
-	if rt := router.staticRoutes[r.URL.Path]; rt != nil {
-		if m := rt.ptr(r.Method); m != nil {
-			if *m != nil {
-				(*m).ServeHTTP(w, r)
+	router.serve(w, r, nil)
+}
+
+// up - цепочка роутеров, в которые смонтирован данный, nullable
+func (router *NanoRouter) serve(w http.ResponseWriter, r *http.Request, up *_Mounted) {
+	if router.Banner != nil {
+		if left := router.Banner.banLeft(r); left > 0 {
+			router.Banner.reject(w, left)
+			return
+		}
+	}
+
+	t := router.load()
+
+	var buf [maxInlineParams]Param
+	if rt, params := t.find(r.URL.Path, buf[:0]); rt != nil {
+		// положим значения параметров в контекст, см. PathParams.
+		// У монтирования префикс статический, а единственный параметр - отрезаемый остаток пути, его не кладем.
+		// В смонтированном роутере в контекст попадает и статический роут: его путь без префикса не годится для RouteTemplate
+		if (len(params) > 0 || up != nil) && rt.mount == nil {
+			template := rt.template
+			for m := up; m != nil; m = m.up {
+				template = m.prefix + template
+			}
+			if !router.PoolRequests {
+				r = withParams(r, template, params)
 			} else {
-				// здесь мы окажемся, если метод не определен для указанного path
-				router.MethodNotAllowed.ServeHTTP(w, r)
+				pr := acquireParamsRequest(r, template, params)
+				router.serveRoute(w, &pr.r, rt, up)
+				// при панике в хендлере запрос просто не вернется в пул
+				pr.release()
+				return
 			}
-		} else {
-			// здесь мы окажемся, если такой метод вообще не знаком роутеру
-			router.MethodNotAllowed.ServeHTTP(w, r)
 		}
+		router.serveRoute(w, r, rt, up)
 		return
 	}
 
-	// Если не найден статический, смотрим среди роутов с одним path param
-	if router.paramRoutes != nil {
-		lastSlash := strings.LastIndexByte(r.URL.Path, '/')
-		if lastSlash > 0 && lastSlash < (len(r.URL.Path)-1) {
-			searchedPath := r.URL.Path[:lastSlash]
-			param := r.URL.Path[lastSlash+1:]
-
-			if rt := router.paramRoutes[searchedPath]; rt != nil {
-				if m := rt.ptr(r.Method); m != nil {
-					if *m != nil {
-						// положим значение параметра в контекст
-						newCtx := context.WithValue(r.Context(), rt.paramName, param)
-						r = r.WithContext(newCtx)
-
-						(*m).ServeHTTP(w, r)
-					} else {
-						// здесь мы окажемся, если метод не определен для указанного path
-						router.MethodNotAllowed.ServeHTTP(w, r)
-					}
+	if fixed := router.fixPath(t, r.URL.Path); fixed != "" {
+		router.redirect(w, r, fixed, up)
+		return
+	}
+
+	router.notFound(w, r, up)
+}
+
+func (router *NanoRouter) serveRoute(w http.ResponseWriter, r *http.Request, rt *_Route, up *_Mounted) {
+	if rt.mount != nil {
+		router.serveMount(w, r, rt.mount, up)
+		return
+	}
+
+	if isPreflight(r) {
+		if c := router.cors(up); c != nil {
+			c.preflight(w, r, rt.allow[0])
+			return
+		}
+	}
+
+	h := rt.handler(r.Method)
+	if h == nil && r.Method == http.MethodHead && rt.get != nil {
+		h, w = rt.get, &_HeadResponseWriter{w}
+	}
+	if h != nil {
+		if c, ok := h.(*_Conditional); ok {
+			var unsupported bool
+			if h, unsupported = c.choose(r); h == nil {
+				if unsupported {
+					router.unsupportedMediaType(w, r, up)
 				} else {
-					// здесь мы окажемся, если такой метод вообще не знаком роутеру
-					router.MethodNotAllowed.ServeHTTP(w, r)
+					// путь есть, но не для этого хоста/версии
+					router.notFound(w, r, up)
 				}
 				return
 			}
 		}
+		h.ServeHTTP(w, r)
+		return
 	}
 
+	if r.Method == http.MethodOptions {
+		w.Header()[HeaderAllow] = rt.allow
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// здесь мы окажемся, если метод не определен для указанного path
+	w.Header()[HeaderAllow] = rt.allow
+	router.methodNotAllowed(w, r, up)
+}
+
+// Смонтированный роутер со стандартными NotFound/MethodNotAllowed делегирует их роутеру, в который смонтирован,
+// с исходным (не обрезанным) запросом
+func (router *NanoRouter) notFound(w http.ResponseWriter, r *http.Request, up *_Mounted) {
+	if up != nil && router.NotFound == http.Handler(&defaultNotFoundHandler) {
+		up.router.notFound(w, up.r, up.up)
+		return
+	}
+	if router.Banner != nil {
+		router.Banner.record(r, http.StatusNotFound)
+	}
 	router.NotFound.ServeHTTP(w, r)
 }
 
+func (router *NanoRouter) methodNotAllowed(w http.ResponseWriter, r *http.Request, up *_Mounted) {
+	if up != nil && router.MethodNotAllowed == http.Handler(&defaultMethodNotAllowedHandler) {
+		up.router.methodNotAllowed(w, up.r, up.up)
+		return
+	}
+	if router.Banner != nil {
+		router.Banner.record(r, http.StatusMethodNotAllowed)
+	}
+	router.MethodNotAllowed.ServeHTTP(w, r)
+}
+
+func (router *NanoRouter) unsupportedMediaType(w http.ResponseWriter, r *http.Request, up *_Mounted) {
+	if up != nil && router.UnsupportedMediaType == http.Handler(&defaultUnsupportedMediaTypeHandler) {
+		up.router.unsupportedMediaType(w, up.r, up.up)
+		return
+	}
+	if router.Banner != nil {
+		router.Banner.record(r, http.StatusUnsupportedMediaType)
+	}
+	router.UnsupportedMediaType.ServeHTTP(w, r)
+}
+
+// Повторная регистрация того же метода и шаблона заменяет хендлер, а в режиме Strict паникует
 func (router *NanoRouter) Handle(method, path string, h http.Handler) {
+	router.handle(nil, method, path, h, false)
+}
+
+// Заменяет хендлер (или добавляет, если его не было), в т.ч. во время работы и в режиме Strict.
+// Возвращает, был ли хендлер до этого
+func (router *NanoRouter) Replace(method, path string, h http.Handler) (replaced bool) {
+	return router.handle(nil, method, path, h, true)
+}
+
+func (router *NanoRouter) handle(cond RouteCondition, method, path string, h http.Handler, replace bool) (existed bool) {
 	if h == nil {
 		panic("handler is nil")
 	}
 	if path == "" {
 		panic("path is empty")
 	}
-	if !isMethodSupported(method) {
-		panic("method " + method + " not supported by router")
+	if !isValidMethod(method) {
+		panic("invalid method '" + method + "'")
 	}
 
-	// статик или с параметром?
-	if index := strings.Index(path, "/:"); index != -1 {
-		newPath := path[:index]
-		paramName := path[index+2:]
+	tokens, err := parseTemplate(path)
+	if err != nil {
+		panic(fmt.Sprintf("%s %s: %s", method, path, err))
+	}
 
-		if router.paramRoutes == nil {
-			router.paramRoutes = make(map[string]*_Route)
-		}
+	router.update(func(t *_RouteTable) {
+		var added *_Route
+		// статик или с параметром?
+		if len(tokens) > 1 {
+			if t.paramRoutes == nil {
+				t.paramRoutes = &_Node{}
+			}
+
+			node, err := t.paramRoutes.insert(path, tokens)
+			if err != nil {
+				panic(fmt.Sprintf("%s %s", method, err))
+			}
+			if node.route == nil {
+				node.route = &_Route{template: path}
+			} else if node.route.mount != nil {
+				panic(fmt.Sprintf("%s %s: conflicts with mount %s", method, path, node.route.mount.prefix))
+			}
+			var merged http.Handler
+			merged, existed = withCondition(node.route.handler(method), cond, h)
+			node.route.set(method, merged)
+			added = node.route
 
-		rt := router.paramRoutes[newPath]
-		if rt == nil {
-			rt = &_Route{paramName: paramName}
-			router.paramRoutes[newPath] = rt
 		} else {
-			if rt.paramName != paramName {
-				panic(fmt.Sprintf("%s %s parameter %s differs from %s declared earlier", method, path, paramName, rt.paramName))
+
+			rt := t.staticRoutes[path]
+			if rt == nil {
+				rt = &_Route{template: path}
+				t.staticRoutes[path] = rt
+			} else if rt.mount != nil {
+				panic(fmt.Sprintf("%s %s: conflicts with mount %s", method, path, rt.mount.prefix))
 			}
+			var merged http.Handler
+			merged, existed = withCondition(rt.handler(method), cond, h)
+			rt.set(method, merged)
+			added = rt
 		}
-		m := rt.ptr(method)
-		*m = h
-
-	} else {
 
-		rt := router.staticRoutes[path]
-		if rt == nil {
-			rt = &_Route{}
-			router.staticRoutes[path] = rt
+		if replace {
+			t.forgetDuplicates(method, path)
+		} else if existed {
+			if router.Strict {
+				panic(fmt.Sprintf("%s %s: duplicate route, use Replace to overwrite", method, path))
+			}
+			t.duplicates = append(t.duplicates, method+" "+path)
 		}
-		m := rt.ptr(method)
-		*m = h
+		router.checkStrict(t, added)
+	})
+	return existed
+}
+
+// Удаляет хендлер метода для шаблона path (шаблон должен совпадать с зарегистрированным в точности).
+// Если у роута не осталось методов, удаляется и он, и его имя. Возвращает, был ли хендлер.
+func (router *NanoRouter) Remove(method, path string) (removed bool) {
+	tokens, err := parseTemplate(path)
+	if err != nil {
+		return false
 	}
+
+	router.update(func(t *_RouteTable) {
+		var rt *_Route
+		var node *_Node
+		if len(tokens) > 1 {
+			if t.paramRoutes != nil {
+				if node = t.paramRoutes.findNode(tokens); node != nil {
+					rt = node.route
+				}
+			}
+		} else {
+			rt = t.staticRoutes[path]
+		}
+		if rt == nil || rt.mount != nil || rt.handler(method) == nil {
+			return
+		}
+
+		removed = true
+		rt.set(method, nil)
+		t.forgetDuplicates(method, path)
+		if len(rt.registeredMethods()) > 0 {
+			return
+		}
+
+		if node != nil {
+			node.route = nil
+			t.paramRoutes.prune()
+		} else {
+			delete(t.staticRoutes, path)
+		}
+		for name, nr := range t.names {
+			if nr.template == path {
+				delete(t.names, name)
+			}
+		}
+	})
+	return removed
 }
 
 func (router *NanoRouter) HandleFunc(method, path string, h http.HandlerFunc) {
@@ -164,6 +434,19 @@ func (h *wrapFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.f(w, r)
 }
 
+// Для HEAD, обслуживаемого GET-хендлером: заголовки и статус пишутся как есть, тело отбрасывается
+type _HeadResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w *_HeadResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *_HeadResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 type defaultHandler struct {
 	code int
 }
@@ -173,6 +456,7 @@ func (h *defaultHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 var (
-	defaultNotFoundHandler         = defaultHandler{code: http.StatusNotFound}
-	defaultMethodNotAllowedHandler = defaultHandler{code: http.StatusMethodNotAllowed}
+	defaultNotFoundHandler             = defaultHandler{code: http.StatusNotFound}
+	defaultMethodNotAllowedHandler     = defaultHandler{code: http.StatusMethodNotAllowed}
+	defaultUnsupportedMediaTypeHandler = defaultHandler{code: http.StatusUnsupportedMediaType}
 )
@@ -2,10 +2,13 @@ package hollander
 
 import (
 	"fmt"
+	"github.com/happywbfriends/nano/xerror"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 )
 
 type TestHandler struct {
@@ -20,10 +23,9 @@ func (h *TestHandler) ServeHTTP(_ http.ResponseWriter, r *http.Request) {
 		h.t.Fatal(fmt.Sprintf("Expected method '%s' got '%s'", h.expectedMethod, r.Method))
 	}
 	if h.expectedParamName != "" {
-		val := r.Context().Value(h.expectedParamName)
-		sval, ok := val.(string)
+		sval, ok := PathParams(r).Get(h.expectedParamName)
 		if !ok {
-			h.t.Fatal(fmt.Sprintf("Expected param '%s' to be a valid string, got '%v'", h.expectedParamName, val))
+			h.t.Fatal(fmt.Sprintf("Expected param '%s' to be present", h.expectedParamName))
 		}
 		if sval != h.expectedParamValue {
 			h.t.Fatal(fmt.Sprintf("Expected param %s='%s' got '%s'", h.expectedParamName, h.expectedParamValue, sval))
@@ -119,6 +121,124 @@ func BenchmarkNanoVsServeMux(b *testing.B) {
 	}
 }
 
+// ResponseWriter без аллокаций, чтобы в бенчмарках считались только аллокации роутера
+type _VoidResponseWriter struct {
+	header http.Header
+}
+
+func (w *_VoidResponseWriter) Header() http.Header         { return w.header }
+func (w *_VoidResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *_VoidResponseWriter) WriteHeader(int)             {}
+
+// Примерно: static и 404 - 35 ns/op, param - 125 ns/op, 405 - 45 ns/op, везде 0 allocs/op (param - с PoolRequests)
+func BenchmarkNanoRouter(b *testing.B) {
+	voidHandleFunc := func(writer http.ResponseWriter, request *http.Request) {}
+	readParamHandleFunc := func(writer http.ResponseWriter, request *http.Request) {
+		_ = PathParam(request, "id")
+	}
+
+	nano := NewRouter()
+	nano.PoolRequests = true
+	for i := 0; i < 20; i++ {
+		nano.HandleFunc("GET", fmt.Sprintf("/some/path/%d", i), voidHandleFunc)
+		nano.HandleFunc("GET", fmt.Sprintf("/api/v%d/orders/:id/items/:item", i), readParamHandleFunc)
+	}
+	nano.HandleFunc("GET", "/users/:id<int>", readParamHandleFunc)
+
+	benchmarks := []struct {
+		name string
+		uri  string
+	}{
+		{"static", "/some/path/7"},
+		{"param", "/api/v7/orders/123/items/456"},
+		{"param constraint", "/users/42"},
+		{"404", "/no/such/path"},
+		{"405", "/some/path/7"},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			r := httptest.NewRequest(http.MethodGet, bm.uri, nil)
+			if bm.name == "405" {
+				r.Method = http.MethodPost
+			}
+			w := &_VoidResponseWriter{header: make(http.Header)}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				nano.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+func TestNanoRouter_Allocs(t *testing.T) {
+	for _, pool := range []bool{false, true} {
+		nano := NewRouter()
+		nano.PoolRequests = pool
+		nano.HandleFunc("GET", "/static", func(http.ResponseWriter, *http.Request) {})
+		nano.HandleFunc("GET", "/orders/:id/items/:item", func(w http.ResponseWriter, r *http.Request) {
+			_ = PathParam(r, "item")
+		})
+		nano.HandleFuncIf(Host("*.example.com"), "GET", "/hosted", func(http.ResponseWriter, *http.Request) {})
+
+		paramAllocs := 1.0
+		if pool {
+			paramAllocs = 0
+		}
+		for uri, maxAllocs := range map[string]float64{"/static": 0, "/orders/1/items/2": paramAllocs, "/none": 0, "/hosted": 0} {
+			r := httptest.NewRequest(http.MethodGet, uri, nil)
+			r.Host = "Shop.Example.com:8080"
+			w := &_VoidResponseWriter{header: make(http.Header)}
+			if allocs := testing.AllocsPerRun(100, func() { nano.ServeHTTP(w, r) }); allocs > maxAllocs {
+				t.Errorf("pool=%v %s: %v allocs, want <= %v", pool, uri, allocs, maxAllocs)
+			}
+		}
+	}
+}
+
+func TestNanoRouter_PooledParams(t *testing.T) {
+	for _, pool := range []bool{false, true} {
+		nano := NewRouter()
+		nano.PoolRequests = pool
+		var kept []*http.Request
+		nano.HandleFunc("GET", "/orders/:id", func(w http.ResponseWriter, r *http.Request) {
+			kept = append(kept, r)
+			_, _ = w.Write([]byte(PathParam(r, "id")))
+		})
+
+		for _, id := range []string{"1", "2", "3"} {
+			w := httptest.NewRecorder()
+			nano.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders/"+id, nil))
+			if w.Body.String() != id {
+				t.Errorf("pool=%v: got '%s', want '%s'", pool, w.Body.String(), id)
+			}
+		}
+		if !pool && (PathParam(kept[0], "id") != "1" || RouteTemplate(kept[0]) != "/orders/:id") {
+			t.Errorf("retained request lost its params")
+		}
+	}
+}
+
+// Без пула запрос переживает хендлер: http.TimeoutHandler выполняет его в своей горутине
+func TestNanoRouter_ParamsAfterReturn(t *testing.T) {
+	nano := NewRouter()
+	got := make(chan string, 1)
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		got <- PathParam(r, "id")
+	})
+	nano.Handle("GET", "/t/:id", http.TimeoutHandler(slow, 5*time.Millisecond, "timeout"))
+
+	w := httptest.NewRecorder()
+	nano.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/t/42", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d, want 503", w.Code)
+	}
+	if id := <-got; id != "42" {
+		t.Errorf("got param '%s' after handler returned, want '42'", id)
+	}
+}
+
 func TestNanoRouter_ServeHTTP(t *testing.T) {
 	tests := []struct {
 		templateMethod     string
@@ -149,3 +269,363 @@ func TestNanoRouter_ServeHTTP(t *testing.T) {
 		})
 	}
 }
+
+func TestNanoRouter_MultiParams(t *testing.T) {
+	nano := NewRouter()
+	nano.NotFound = &FailTestHandler{t, "unexpected NotFound handler call"}
+	nano.MethodNotAllowed = &FailTestHandler{t, "unexpected MethodNotAllowed handler call"}
+
+	var got string
+	handle := func(path string, params ...string) {
+		nano.HandleFunc("GET", path, func(_ http.ResponseWriter, r *http.Request) {
+			got = path
+			for _, p := range params {
+				got += fmt.Sprintf(" %s=%s", p, PathParam(r, p))
+			}
+		})
+	}
+
+	handle("/suppliers/:supplierId/orders/:orderId", "supplierId", "orderId")
+	handle("/suppliers/:supplierId/orders/new", "supplierId")
+	handle("/suppliers/:supplierId", "supplierId")
+	handle("/suppliers/:supplierId/stocks", "supplierId")
+	handle("/suppliers/list")
+	handle("/stocks/:id/:wh", "id", "wh")
+
+	tests := []struct {
+		callUri  string
+		expected string
+	}{
+		{"/suppliers/1/orders/2", "/suppliers/:supplierId/orders/:orderId supplierId=1 orderId=2"},
+		{"/suppliers/1/orders/new", "/suppliers/:supplierId/orders/new supplierId=1"},
+		{"/suppliers/1", "/suppliers/:supplierId supplierId=1"},
+		{"/suppliers/1/stocks", "/suppliers/:supplierId/stocks supplierId=1"},
+		{"/suppliers/list", "/suppliers/list"},
+		{"/stocks/5/7", "/stocks/:id/:wh id=5 wh=7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.callUri, func(t *testing.T) {
+			got = ""
+			nano.ServeHTTP(nil, NewRequestMock("GET", tt.callUri))
+			if got != tt.expected {
+				t.Errorf("got '%s', want '%s'", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNanoRouter_NotFound(t *testing.T) {
+	nano := NewRouter()
+	nano.HandleFunc("GET", "/suppliers/:supplierId/orders/:orderId", func(http.ResponseWriter, *http.Request) {
+		t.Fatal("unexpected handler call")
+	})
+
+	for _, uri := range []string{"/suppliers", "/suppliers/1", "/suppliers/1/orders", "/suppliers/1/orders/", "/suppliers//orders/2", "/suppliers/1/orders/2/x"} {
+		t.Run(uri, func(t *testing.T) {
+			notFound := false
+			nano.NotFound = http.HandlerFunc(func(http.ResponseWriter, *http.Request) { notFound = true })
+			nano.ServeHTTP(nil, NewRequestMock("GET", uri))
+			if !notFound {
+				t.Errorf("expected NotFound for %s", uri)
+			}
+		})
+	}
+}
+
+func TestNanoRouter_ParamNameConflict(t *testing.T) {
+	nano := NewRouter()
+	nano.HandleFunc("GET", "/a/:id/b", func(http.ResponseWriter, *http.Request) {})
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic on conflicting parameter names")
+		}
+	}()
+	nano.HandleFunc("GET", "/a/:name/c", func(http.ResponseWriter, *http.Request) {})
+}
+
+func TestNanoRouter_CatchAll(t *testing.T) {
+	nano := NewRouter()
+	nano.MethodNotAllowed = &FailTestHandler{t, "unexpected MethodNotAllowed handler call"}
+
+	var got string
+	handle := func(path string, params ...string) {
+		nano.HandleFunc("GET", path, func(_ http.ResponseWriter, r *http.Request) {
+			got = path
+			for _, p := range params {
+				got += fmt.Sprintf(" %s=%s", p, PathParam(r, p))
+			}
+		})
+	}
+
+	handle("/files/*path", "path")
+	handle("/files/:name", "name")
+	handle("/files/static/readme")
+	handle("/upstream/:version/*rest", "version", "rest")
+
+	tests := []struct {
+		callUri  string
+		expected string
+	}{
+		{"/files/", "/files/*path path="},
+		{"/files/a/b.txt", "/files/*path path=a/b.txt"},
+		{"/files/a.txt", "/files/:name name=a.txt"},
+		{"/files/static/readme", "/files/static/readme"},
+		{"/files/static/readme/x", "/files/*path path=static/readme/x"},
+		{"/upstream/v1/a/b/", "/upstream/:version/*rest version=v1 rest=a/b/"},
+		{"/upstream/v1/", "/upstream/:version/*rest version=v1 rest="},
+		{"/files", ""},
+		{"/upstream/v1", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.callUri, func(t *testing.T) {
+			got = ""
+			nano.NotFound = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+			nano.ServeHTTP(nil, NewRequestMock("GET", tt.callUri))
+			if got != tt.expected {
+				t.Errorf("got '%s', want '%s'", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNanoRouter_CatchAllNotLast(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic on catch-all in the middle of template")
+		}
+	}()
+	NewRouter().HandleFunc("GET", "/files/*path/x", func(http.ResponseWriter, *http.Request) {})
+}
+
+func TestPathParamInt(t *testing.T) {
+	nano := NewRouter()
+
+	var got int
+	var xe xerror.IError
+	nano.HandleFunc("GET", "/orders/:id", func(_ http.ResponseWriter, r *http.Request) {
+		got, xe = PathParamInt(r, "id")
+	})
+	nano.HandleFunc("GET", "/stocks/:id", func(_ http.ResponseWriter, r *http.Request) {
+		got, xe = PathParamInt(r, "wh")
+	})
+
+	tests := []struct {
+		callUri        string
+		expected       int
+		expectedStatus int
+	}{
+		{"/orders/42", 42, 0},
+		{"/orders/abc", 0, http.StatusBadRequest},
+		{"/stocks/1", 0, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.callUri, func(t *testing.T) {
+			got, xe = 0, nil
+			nano.ServeHTTP(nil, NewRequestMock("GET", tt.callUri))
+			if got != tt.expected {
+				t.Errorf("got %d, want %d", got, tt.expected)
+			}
+			status := 0
+			if xe != nil {
+				status = xe.HttpStatus()
+			}
+			if status != tt.expectedStatus {
+				t.Errorf("got status %d, want %d", status, tt.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestNanoRouter_Constraints(t *testing.T) {
+	nano := NewRouter()
+	nano.MethodNotAllowed = &FailTestHandler{t, "unexpected MethodNotAllowed handler call"}
+
+	var got string
+	handle := func(path string, param string) {
+		nano.HandleFunc("GET", path, func(_ http.ResponseWriter, r *http.Request) {
+			got = path + " " + param + "=" + PathParam(r, param)
+		})
+	}
+
+	handle("/api/:id<int>", "id")
+	handle("/api/:uuid<uuid>", "uuid")
+	handle("/api/:name", "name")
+	handle("/items/:sku<[A-Z0-9]{8}>/info", "sku")
+	handle("/dates/:date<(?P<y>\\d{4})-\\d{2}>", "date")
+
+	tests := []struct {
+		callUri  string
+		expected string
+	}{
+		{"/api/123", "/api/:id<int> id=123"},
+		{"/api/-5", "/api/:id<int> id=-5"},
+		{"/api/6f0c3a8e-2b1d-4c5e-9f7a-0123456789ab", "/api/:uuid<uuid> uuid=6f0c3a8e-2b1d-4c5e-9f7a-0123456789ab"},
+		{"/api/abc", "/api/:name name=abc"},
+		{"/items/AB12CD34/info", "/items/:sku<[A-Z0-9]{8}>/info sku=AB12CD34"},
+		{"/items/ab12cd34/info", ""},
+		{"/items/AB12CD345/info", ""},
+		{"/dates/2023-04", "/dates/:date<(?P<y>\\d{4})-\\d{2}> date=2023-04"},
+		{"/dates/23-04", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.callUri, func(t *testing.T) {
+			got = ""
+			nano.NotFound = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+			nano.ServeHTTP(nil, NewRequestMock("GET", tt.callUri))
+			if got != tt.expected {
+				t.Errorf("got '%s', want '%s'", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNanoRouter_MalformedConstraints(t *testing.T) {
+	for _, path := range []string{"/api/:id<>", "/api/:id<int", "/api/:id<[a-z>", "/api/:id<int>x", "/files/*path<int>"} {
+		t.Run(path, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for %s", path)
+				}
+			}()
+			NewRouter().HandleFunc("GET", path, func(http.ResponseWriter, *http.Request) {})
+		})
+	}
+}
+
+func TestNanoRouter_AutoMethods(t *testing.T) {
+	nano := NewRouter()
+	body := func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(HeaderContentType, ContentTypeText)
+		_, _ = w.Write([]byte("body"))
+	}
+	nano.HandleFunc("GET", "/static", body)
+	nano.HandleFunc("POST", "/static", body)
+	nano.HandleFunc("PROPFIND", "/static", body)
+	nano.HandleFunc("GET", "/param/:id", body)
+	nano.HandleFunc("OPTIONS", "/explicit", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	tests := []struct {
+		method         string
+		callUri        string
+		expectedStatus int
+		expectedAllow  string
+		expectedBody   string
+	}{
+		{"GET", "/static", http.StatusOK, "", "body"},
+		{"HEAD", "/static", http.StatusOK, "", ""},
+		{"PROPFIND", "/static", http.StatusOK, "", "body"},
+		{"OPTIONS", "/static", http.StatusNoContent, "GET, HEAD, OPTIONS, POST, PROPFIND", ""},
+		{"DELETE", "/static", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS, POST, PROPFIND", ""},
+		{"QUERY", "/static", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS, POST, PROPFIND", ""},
+		{"HEAD", "/param/1", http.StatusOK, "", ""},
+		{"PUT", "/param/1", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS", ""},
+		{"OPTIONS", "/explicit", http.StatusTeapot, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.callUri, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			nano.ServeHTTP(w, NewRequestMock(tt.method, tt.callUri))
+			if w.Code != tt.expectedStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.expectedStatus)
+			}
+			if allow := w.Header().Get(HeaderAllow); allow != tt.expectedAllow {
+				t.Errorf("got Allow '%s', want '%s'", allow, tt.expectedAllow)
+			}
+			if w.Body.String() != tt.expectedBody {
+				t.Errorf("got body '%s', want '%s'", w.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestNanoRouter_InvalidMethod(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic on invalid method")
+		}
+	}()
+	NewRouter().HandleFunc("GET POST", "/", func(http.ResponseWriter, *http.Request) {})
+}
+
+func TestNanoRouter_Redirects(t *testing.T) {
+	nano := NewRouter()
+	nano.RedirectTrailingSlash = true
+	nano.RedirectCleanPath = true
+	nano.RedirectCaseInsensitive = true
+
+	void := func(http.ResponseWriter, *http.Request) {}
+	nano.HandleFunc("GET", "/orders", void)
+	nano.HandleFunc("POST", "/orders", void)
+	nano.HandleFunc("GET", "/dirs/", void)
+	nano.HandleFunc("GET", "/Suppliers/:id/Stocks", void)
+
+	sub := NewRouter()
+	sub.RedirectTrailingSlash = true
+	sub.HandleFunc("GET", "/invoices", void)
+	nano.Mount("/billing", sub)
+
+	tests := []struct {
+		method           string
+		callUri          string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{"GET", "/orders", http.StatusOK, ""},
+		{"GET", "/orders/", http.StatusMovedPermanently, "/orders"},
+		{"POST", "/orders/", http.StatusPermanentRedirect, "/orders"},
+		{"GET", "/orders/?a=b", http.StatusMovedPermanently, "/orders?a=b"},
+		{"GET", "/dirs", http.StatusMovedPermanently, "/dirs/"},
+		{"GET", "//orders", http.StatusMovedPermanently, "/orders"},
+		{"GET", "/x/../orders", http.StatusMovedPermanently, "/orders"},
+		{"GET", "/ORDERS", http.StatusMovedPermanently, "/orders"},
+		{"GET", "/suppliers/AbC/stocks/", http.StatusMovedPermanently, "/Suppliers/AbC/Stocks"},
+		{"GET", "/billing/invoices/", http.StatusMovedPermanently, "/billing/invoices"},
+		{"GET", "/unknown/", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.callUri, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, "http://example.com/", nil)
+			r.URL, _ = url.ParseRequestURI(tt.callUri)
+			nano.ServeHTTP(w, r)
+			if w.Code != tt.expectedStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.expectedStatus)
+			}
+			if location := w.Header().Get("Location"); location != tt.expectedLocation {
+				t.Errorf("got Location '%s', want '%s'", location, tt.expectedLocation)
+			}
+		})
+	}
+}
+
+// Шаблоны, различающиеся только регистром: точное совпадение, иначе всегда один и тот же шаблон
+func TestRouteTable_FindFold(t *testing.T) {
+	nano := NewRouter()
+	void := func(http.ResponseWriter, *http.Request) {}
+	for _, p := range []string{"/reports/daily", "/reports/Daily", "/Reports/daily", "/REPORTS/DAILY"} {
+		nano.HandleFunc("GET", p, void)
+	}
+
+	for i := 0; i < 20; i++ {
+		if fixed, _ := nano.load().findFold("/reports/Daily"); fixed != "/reports/Daily" {
+			t.Fatalf("got '%s', want exact match", fixed)
+		}
+		if fixed, _ := nano.load().findFold("/Reports/DAILY"); fixed != "/REPORTS/DAILY" {
+			t.Fatalf("got '%s', want '/REPORTS/DAILY'", fixed)
+		}
+	}
+}
+
+func TestNanoRouter_NoRedirectsByDefault(t *testing.T) {
+	nano := NewRouter()
+	nano.HandleFunc("GET", "/orders", func(http.ResponseWriter, *http.Request) {})
+
+	w := httptest.NewRecorder()
+	nano.ServeHTTP(w, httptest.NewRequest("GET", "/orders/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,158 @@
+package hollander
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Описание зарегистрированного роута
+type RouteInfo struct {
+	Method      string       `json:"method"`   // для Mount чужого http.Handler - "*"
+	Template    string       `json:"template"` // полный шаблон, с префиксами групп и монтирования
+	Condition   string       `json:"condition,omitempty"`
+	HandlerName string       `json:"handler"`
+	Handler     http.Handler `json:"-"`
+}
+
+const anyMethod = "*"
+
+/*
+	Все роуты роутера, отсортированные по шаблону и методу.
+	Роуты смонтированных *NanoRouter раскрываются с префиксом, прочие смонтированные хендлеры
+	описываются одной записью с методом "*" и шаблоном prefix/*.
+	Неявные HEAD и OPTIONS (см. serveRoute) не включаются.
+	Варианты роута с условиями (HandleIf) описываются отдельными записями в порядке проверки.
+*/
+func (router *NanoRouter) Routes() []RouteInfo {
+	var routes []RouteInfo
+	router.collectRoutes("", &routes)
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Template != routes[j].Template {
+			return routes[i].Template < routes[j].Template
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+func (router *NanoRouter) collectRoutes(prefix string, routes *[]RouteInfo) {
+	mounts := make(map[*_Mount]struct{})
+
+	add := func(rt *_Route) {
+		if rt.mount != nil {
+			// монтирование зарегистрировано дважды: статикой и catch-all
+			if _, seen := mounts[rt.mount]; seen {
+				return
+			}
+			mounts[rt.mount] = struct{}{}
+
+			if sub, ok := rt.mount.h.(*NanoRouter); ok {
+				sub.collectRoutes(prefix+rt.mount.prefix, routes)
+			} else {
+				*routes = append(*routes, newRouteInfo(anyMethod, prefix+rt.mount.prefix+"/*", rt.mount.h))
+			}
+			return
+		}
+		for _, method := range rt.registeredMethods() {
+			h := rt.handler(method)
+			c, ok := h.(*_Conditional)
+			if !ok {
+				*routes = append(*routes, newRouteInfo(method, prefix+rt.template, h))
+				continue
+			}
+			for _, v := range c.variants {
+				info := newRouteInfo(method, prefix+rt.template, v.h)
+				info.Condition = v.cond.String()
+				*routes = append(*routes, info)
+			}
+			if c.fallback != nil {
+				*routes = append(*routes, newRouteInfo(method, prefix+rt.template, c.fallback))
+			}
+		}
+	}
+
+	t := router.load()
+	for _, rt := range t.staticRoutes {
+		add(rt)
+	}
+	if t.paramRoutes != nil {
+		t.paramRoutes.walk(func(n *_Node) {
+			if n.route != nil {
+				add(n.route)
+			}
+		})
+	}
+}
+
+func newRouteInfo(method, template string, h http.Handler) RouteInfo {
+	return RouteInfo{
+		Method:      method,
+		Template:    template,
+		HandlerName: handlerName(h),
+		Handler:     h,
+	}
+}
+
+// Для функций - полное имя функции, для остальных - тип
+func handlerName(h http.Handler) string {
+	var f interface{}
+	switch hh := h.(type) {
+	case *wrapFunc:
+		f = hh.f
+	case http.HandlerFunc:
+		f = hh
+	default:
+		return fmt.Sprintf("%T", h)
+	}
+	if fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer()); fn != nil {
+		return fn.Name()
+	}
+	return fmt.Sprintf("%T", f)
+}
+
+func (n *_Node) walk(f func(n *_Node)) {
+	f(n)
+	for _, c := range n.statics {
+		c.walk(f)
+	}
+	for _, p := range n.params {
+		p.walk(f)
+	}
+	if n.catchAll != nil {
+		n.catchAll.walk(f)
+	}
+}
+
+/*
+	Отладочный хендлер с таблицей роутов: JSON, если клиент принимает application/json или передан ?format=json,
+	иначе текстом. Таблица строится на каждый запрос, поэтому видны и роуты, добавленные после регистрации хендлера.
+
+	router.Handle(http.MethodGet, "/debug/routes", router.RoutesHandler())
+*/
+func (router *NanoRouter) RoutesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		routes := router.Routes()
+
+		if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get(HeaderAccept), ContentTypeJSON) {
+			w.Header().Set(HeaderContentType, ContentTypeJSON)
+			if err := json.NewEncoder(w).Encode(routes); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set(HeaderContentType, ContentTypeText)
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, rt := range routes {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", rt.Method, rt.Template, rt.Condition, rt.HandlerName)
+		}
+		_ = tw.Flush()
+	})
+}
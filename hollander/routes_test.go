@@ -0,0 +1,64 @@
+package hollander
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func voidRoutesTestHandler(http.ResponseWriter, *http.Request) {}
+
+func TestNanoRouter_Routes(t *testing.T) {
+	billing := NewRouter()
+	billing.HandleFunc("GET", "/invoices/:id", voidRoutesTestHandler)
+
+	router := NewRouter()
+	router.HandleFunc("GET", "/orders", voidRoutesTestHandler)
+	router.HandleFunc("POST", "/orders", voidRoutesTestHandler)
+	router.HandleFunc("PROPFIND", "/orders/:id", voidRoutesTestHandler)
+	router.Group("/api").Serve("GET", "/stocks/*rest")
+	router.Mount("/billing", billing)
+	router.Mount("/debug", http.NotFoundHandler())
+
+	var got []string
+	for _, rt := range router.Routes() {
+		got = append(got, rt.Method+" "+rt.Template+" "+rt.HandlerName)
+	}
+	expected := []string{
+		"GET /api/stocks/*rest *hollander.Middleware",
+		"GET /billing/invoices/:id github.com/happywbfriends/http/hollander.voidRoutesTestHandler",
+		"* /debug/* net/http.NotFound",
+		"GET /orders github.com/happywbfriends/http/hollander.voidRoutesTestHandler",
+		"POST /orders github.com/happywbfriends/http/hollander.voidRoutesTestHandler",
+		"PROPFIND /orders/:id github.com/happywbfriends/http/hollander.voidRoutesTestHandler",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestNanoRouter_RoutesHandler(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("GET", "/orders/:id", voidRoutesTestHandler)
+	router.Handle("GET", "/debug/routes", router.RoutesHandler())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/debug/routes?format=json", nil))
+
+	var routes []RouteInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &routes); err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 || routes[1].Template != "/orders/:id" {
+		t.Errorf("unexpected routes %+v", routes)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/debug/routes", nil))
+	if !strings.Contains(w.Body.String(), "GET  /orders/:id") {
+		t.Errorf("unexpected text routes:\n%s", w.Body.String())
+	}
+}
@@ -0,0 +1,115 @@
+package hollander
+
+import "net/http"
+
+/*
+	Таблица роутов NanoRouter. Таблица, опубликованная через NanoRouter.table, никогда не меняется:
+	читатели (ServeHTTP) берут текущий снимок без блокировок, а писатели (Handle, Remove, Mount, ...)
+	под мьютексом копируют таблицу, меняют копию и атомарно подменяют снимок (copy-on-write).
+
+	Поэтому запись стоит O(числа роутов), что не имеет значения при старте и редкой перенастройке,
+	зато поиск роута остается таким же быстрым, как у неизменяемой таблицы.
+*/
+type _RouteTable struct {
+	staticRoutes map[string]*_Route      // полностью статичные роуты
+	paramRoutes  *_Node                  // дерево роутов с path params, nullable
+	names        map[string]*_NamedRoute // именованные роуты для построения URL, nullable
+	duplicates   []string                // повторные регистрации через Handle, для Validate
+}
+
+func newRouteTable() *_RouteTable {
+	return &_RouteTable{
+		staticRoutes: make(map[string]*_Route),
+	}
+}
+
+func (router *NanoRouter) load() *_RouteTable {
+	return router.table.Load().(*_RouteTable)
+}
+
+// Применяет f к копии таблицы и публикует ее. Если f паникует, опубликованная таблица не меняется.
+func (router *NanoRouter) update(f func(t *_RouteTable)) {
+	router.mu.Lock()
+	defer router.mu.Unlock()
+
+	t := router.load().clone()
+	f(t)
+	router.table.Store(t)
+}
+
+// Удаленный или замененный через Replace метод больше не дубликат
+func (t *_RouteTable) forgetDuplicates(method, path string) {
+	key := method + " " + path
+	kept := t.duplicates[:0]
+	for _, d := range t.duplicates {
+		if d != key {
+			kept = append(kept, d)
+		}
+	}
+	t.duplicates = kept
+}
+
+func (t *_RouteTable) clone() *_RouteTable {
+	c := &_RouteTable{
+		staticRoutes: make(map[string]*_Route, len(t.staticRoutes)),
+	}
+	for path, rt := range t.staticRoutes {
+		c.staticRoutes[path] = rt.clone()
+	}
+	if t.paramRoutes != nil {
+		c.paramRoutes = t.paramRoutes.clone()
+	}
+	c.duplicates = append([]string(nil), t.duplicates...)
+	if t.names != nil {
+		// _NamedRoute не меняется после создания, копировать его не нужно
+		c.names = make(map[string]*_NamedRoute, len(t.names))
+		for name, nr := range t.names {
+			c.names[name] = nr
+		}
+	}
+	return c
+}
+
+func (n *_Node) clone() *_Node {
+	c := *n
+	c.statics = make([]*_Node, len(n.statics))
+	for i, s := range n.statics {
+		c.statics[i] = s.clone()
+	}
+	c.params = make([]*_Node, len(n.params))
+	for i, p := range n.params {
+		c.params[i] = p.clone()
+	}
+	if n.catchAll != nil {
+		c.catchAll = n.catchAll.clone()
+	}
+	if n.route != nil {
+		c.route = n.route.clone()
+	}
+	return &c
+}
+
+// _Mount не меняется после создания и остается общим
+func (rt *_Route) clone() *_Route {
+	c := *rt
+	if rt.other != nil {
+		c.other = make(map[string]http.Handler, len(rt.other))
+		for m, h := range rt.other {
+			c.other[m] = h
+		}
+	}
+	return &c
+}
+
+// Поиск роута. Для роутов с параметрами их значения дописываются в params
+func (t *_RouteTable) find(path string, params Params) (*_Route, Params) {
+	if rt := t.staticRoutes[path]; rt != nil {
+		return rt, params
+	}
+	if t.paramRoutes != nil {
+		if node, ps := t.paramRoutes.lookup(path, params); node != nil {
+			return node.route, ps
+		}
+	}
+	return nil, params
+}
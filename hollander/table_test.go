@@ -0,0 +1,115 @@
+package hollander
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestNanoRouter_RemoveReplace(t *testing.T) {
+	router := NewRouter()
+
+	reply := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(body))
+		}
+	}
+	call := func(method, uri string) (int, string) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, uri, nil))
+		return w.Code, w.Body.String()
+	}
+	expect := func(method, uri string, expectedCode int, expectedBody string) {
+		t.Helper()
+		if code, body := call(method, uri); code != expectedCode || body != expectedBody {
+			t.Errorf("%s %s: got %d '%s', want %d '%s'", method, uri, code, body, expectedCode, expectedBody)
+		}
+	}
+
+	router.HandleNamed("order", "GET", "/orders/:id", reply("v1"))
+	router.Handle("POST", "/orders/:id", reply("post"))
+	router.Handle("GET", "/static", reply("static"))
+	router.Mount("/m", reply("mounted"))
+
+	if !router.Replace("GET", "/orders/:id", reply("v2")) {
+		t.Error("Replace should report existing handler")
+	}
+	expect("GET", "/orders/1", http.StatusOK, "v2")
+
+	if router.Replace("PUT", "/orders/:id", reply("put")) {
+		t.Error("Replace should report absent handler")
+	}
+	expect("PUT", "/orders/1", http.StatusOK, "put")
+
+	if !router.Remove("GET", "/orders/:id") {
+		t.Error("Remove should report existing handler")
+	}
+	if router.Remove("GET", "/orders/:id") {
+		t.Error("second Remove should report absent handler")
+	}
+	if router.Remove("GET", "/orders/:orderId") {
+		t.Error("Remove should require exact template")
+	}
+	expect("GET", "/orders/1", http.StatusMethodNotAllowed, "")
+	expect("POST", "/orders/1", http.StatusOK, "post")
+
+	router.Remove("POST", "/orders/:id")
+	router.Remove("PUT", "/orders/:id")
+	expect("GET", "/orders/1", http.StatusNotFound, "")
+	if _, err := router.URL("order", "id", "1"); err == nil {
+		t.Error("name of removed route should be removed")
+	}
+
+	// после удаления ветка дерева освобождена, и параметр можно назвать иначе
+	router.Handle("GET", "/orders/:orderId", reply("renamed"))
+	expect("GET", "/orders/1", http.StatusOK, "renamed")
+
+	router.Remove("GET", "/static")
+	expect("GET", "/static", http.StatusNotFound, "")
+
+	if !router.Unmount("/m/") {
+		t.Error("Unmount should report existing mount")
+	}
+	expect("GET", "/m/x", http.StatusNotFound, "")
+	expect("GET", "/m", http.StatusNotFound, "")
+}
+
+// Запускать с -race
+func TestNanoRouter_ConcurrentReconfiguration(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("GET", "/stable/:id", func(http.ResponseWriter, *http.Request) {})
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest("GET", "/stable/1", nil))
+				if w.Code != http.StatusOK {
+					t.Errorf("stable route got %d", w.Code)
+					return
+				}
+				router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/tenant/3/x", nil))
+			}
+		}()
+	}
+
+	for i := 0; i < 200; i++ {
+		path := fmt.Sprintf("/tenant/%d/:id", i%5)
+		router.HandleFunc("GET", path, func(http.ResponseWriter, *http.Request) {})
+		router.Remove("GET", path)
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -1,8 +1,14 @@
 package hollander
 
 const (
-	HeaderContentType = "Content-Type"
-	HeaderRequestId   = "X-Request-ID"
-	ContentTypeJSON   = "application/json"
-	ContentTypeText   = "text/plain"
+	HeaderContentType      = "Content-Type"
+	HeaderRequestId        = "X-Request-ID"
+	HeaderAllow            = "Allow"
+	HeaderAccept           = "Accept"
+	HeaderAcceptVersion    = "Accept-Version"
+	ContentTypeJSON        = "application/json"
+	ContentTypeText        = "text/plain"
+	ContentTypeForm        = "application/x-www-form-urlencoded"
+	ContentTypeCSV         = "text/csv"
+	ContentTypeProblemJSON = "application/problem+json"
 )
@@ -0,0 +1,384 @@
+package hollander
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+	Префиксное (radix) дерево для роутов с path-параметрами.
+
+	Статические фрагменты шаблона хранятся в сжатом виде (общие префиксы выносятся в отдельный узел),
+	параметр всегда занимает целый сегмент пути: /suppliers/:supplierId/orders/:orderId
+	Параметр может иметь ограничение (см. _Constraint): /api/:id<int>. На одной позиции допускается несколько
+	параметров с разными ограничениями, тогда они пробуются в порядке регистрации, параметр без ограничения - последним.
+	Шаблон может заканчиваться catch-all сегментом: /files/*path. Он захватывает весь остаток пути
+	вместе со слэшами (без ведущего слэша, может быть пустым): /files/a/b.txt -> path=a/b.txt
+
+	При поиске на каждом узле сперва пробуем статических потомков, затем параметр, затем catch-all,
+	т.е. статика > :param<constraint> > :param > *catchAll. Если ветка не привела к роуту, откатываемся и пробуем следующую.
+*/
+
+type _NodeKind uint8
+
+const (
+	nodeStatic _NodeKind = iota
+	nodeParam
+	nodeCatchAll
+)
+
+type _Node struct {
+	kind       _NodeKind
+	prefix     string       // для static: фрагмент пути; для param и catchAll: имя параметра
+	constraint *_Constraint // только для param, nullable
+	statics    []*_Node     // статические потомки, у всех разный первый байт prefix
+	params     []*_Node     // потомки-параметры, без ограничения - всегда последний
+	catchAll   *_Node       // потомок catch-all, всегда терминальный, nullable
+	route      *_Route      // если на этом узле заканчивается шаблон, nullable
+}
+
+// Фрагмент шаблона: либо статический кусок, либо параметр
+type _Token struct {
+	kind       _NodeKind
+	value      string
+	constraint *_Constraint
+}
+
+// Разбирает шаблон на статические фрагменты и параметры
+func parseTemplate(template string) ([]_Token, error) {
+	if template == "" || template[0] != '/' {
+		return nil, fmt.Errorf("template '%s' should start with '/'", template)
+	}
+
+	var tokens []_Token
+	names := make(map[string]struct{})
+
+	rest := template
+	for rest != "" {
+		i := indexParamStart(rest)
+		if i == -1 {
+			tokens = append(tokens, _Token{nodeStatic, rest, nil})
+			break
+		}
+
+		kind := nodeParam
+		if rest[i+1] == '*' {
+			kind = nodeCatchAll
+		}
+
+		tokens = append(tokens, _Token{nodeStatic, rest[:i+1], nil})
+		rest = rest[i+2:]
+
+		// имя параметра идет до '/', '<' или до конца шаблона
+		end := strings.IndexAny(rest, "/<")
+		if end == -1 {
+			end = len(rest)
+		}
+		name := rest[:end]
+		if name == "" {
+			return nil, fmt.Errorf("template '%s' has parameter without name", template)
+		}
+		if _, dup := names[name]; dup {
+			return nil, fmt.Errorf("template '%s' has duplicate parameter '%s'", template, name)
+		}
+		names[name] = struct{}{}
+		rest = rest[end:]
+
+		var constraint *_Constraint
+		if rest != "" && rest[0] == '<' {
+			if kind == nodeCatchAll {
+				return nil, fmt.Errorf("template '%s': catch-all parameter cannot have constraint", template)
+			}
+			closing := indexConstraintEnd(rest)
+			if closing == -1 {
+				return nil, fmt.Errorf("template '%s': unclosed constraint of parameter '%s'", template, name)
+			}
+			c, err := newConstraint(rest[1:closing])
+			if err != nil {
+				return nil, fmt.Errorf("template '%s' parameter '%s': %s", template, name, err)
+			}
+			constraint = c
+			rest = rest[closing+1:]
+			if rest != "" && rest[0] != '/' {
+				return nil, fmt.Errorf("template '%s': constraint of parameter '%s' should end the segment", template, name)
+			}
+		}
+
+		if kind == nodeCatchAll && rest != "" {
+			return nil, fmt.Errorf("template '%s': catch-all parameter should be the last segment", template)
+		}
+
+		tokens = append(tokens, _Token{kind, name, constraint})
+	}
+
+	return tokens, nil
+}
+
+// Позиция слэша, за которым начинается :param или *catchAll, либо -1
+func indexParamStart(s string) int {
+	for i := 0; i < len(s)-1; i++ {
+		if s[i] == '/' && (s[i+1] == ':' || s[i+1] == '*') {
+			return i
+		}
+	}
+	return -1
+}
+
+// Позиция '>', закрывающей ограничение, которое начинается с s[0] == '<', либо -1.
+// Учитывает вложенные <> (именованные группы в regexp) и экранирование.
+func indexConstraintEnd(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '<':
+			depth++
+		case '>':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Возвращает узел, соответствующий шаблону, создавая недостающие
+func (n *_Node) insert(template string, tokens []_Token) (*_Node, error) {
+	cur := n
+	for _, tok := range tokens {
+		switch tok.kind {
+		case nodeStatic:
+			cur = cur.insertStatic(tok.value)
+		case nodeParam:
+			p := cur.findParam(tok.constraint)
+			if p == nil {
+				p = &_Node{kind: nodeParam, prefix: tok.value, constraint: tok.constraint}
+				cur.addParam(p)
+			} else if p.prefix != tok.value {
+				return nil, fmt.Errorf("%s parameter %s differs from %s declared earlier", template, tok.value, p.prefix)
+			}
+			cur = p
+		case nodeCatchAll:
+			if cur.catchAll == nil {
+				cur.catchAll = &_Node{kind: nodeCatchAll, prefix: tok.value}
+			} else if cur.catchAll.prefix != tok.value {
+				return nil, fmt.Errorf("%s catch-all parameter %s differs from %s declared earlier", template, tok.value, cur.catchAll.prefix)
+			}
+			cur = cur.catchAll
+		}
+	}
+	return cur, nil
+}
+
+// Узел, в точности соответствующий шаблону, без создания новых, либо nil
+func (n *_Node) findNode(tokens []_Token) *_Node {
+	cur := n
+	for _, tok := range tokens {
+		switch tok.kind {
+		case nodeStatic:
+			for s := tok.value; s != ""; {
+				var next *_Node
+				for _, c := range cur.statics {
+					if strings.HasPrefix(s, c.prefix) {
+						next = c
+						break
+					}
+				}
+				if next == nil {
+					return nil
+				}
+				cur = next
+				s = s[len(next.prefix):]
+			}
+		case nodeParam:
+			cur = cur.findParam(tok.constraint)
+		case nodeCatchAll:
+			cur = cur.catchAll
+		}
+		if cur == nil || (tok.kind != nodeStatic && cur.prefix != tok.value) {
+			return nil
+		}
+	}
+	return cur
+}
+
+// Удаляет поддеревья без роутов (остаются после Remove). Возвращает, пуст ли сам узел
+func (n *_Node) prune() bool {
+	statics := n.statics[:0]
+	for _, c := range n.statics {
+		if !c.prune() {
+			statics = append(statics, c)
+		}
+	}
+	n.statics = statics
+
+	params := n.params[:0]
+	for _, p := range n.params {
+		if !p.prune() {
+			params = append(params, p)
+		}
+	}
+	n.params = params
+
+	if n.catchAll != nil && n.catchAll.prune() {
+		n.catchAll = nil
+	}
+
+	return n.route == nil && len(n.statics) == 0 && len(n.params) == 0 && n.catchAll == nil
+}
+
+// Потомок-параметр с тем же ограничением (или без ограничения, если c == nil)
+func (n *_Node) findParam(c *_Constraint) *_Node {
+	for _, p := range n.params {
+		if p.constraint == nil && c == nil {
+			return p
+		}
+		if p.constraint != nil && c != nil && p.constraint.source == c.source {
+			return p
+		}
+	}
+	return nil
+}
+
+func (n *_Node) addParam(p *_Node) {
+	last := len(n.params) - 1
+	if p.constraint == nil || last == -1 || n.params[last].constraint != nil {
+		n.params = append(n.params, p)
+		return
+	}
+	// параметр без ограничения остается последним
+	n.params = append(n.params[:last], p, n.params[last])
+}
+
+func (n *_Node) insertStatic(s string) *_Node {
+	if s == "" {
+		return n
+	}
+
+	for _, c := range n.statics {
+		if c.prefix[0] != s[0] {
+			continue
+		}
+
+		l := commonPrefixLen(c.prefix, s)
+		if l < len(c.prefix) {
+			// делим узел: общий префикс остается в c, хвост уходит в нового потомка
+			tail := &_Node{
+				kind:     nodeStatic,
+				prefix:   c.prefix[l:],
+				statics:  c.statics,
+				params:   c.params,
+				catchAll: c.catchAll,
+				route:    c.route,
+			}
+			*c = _Node{
+				kind:    nodeStatic,
+				prefix:  c.prefix[:l],
+				statics: []*_Node{tail},
+			}
+		}
+		return c.insertStatic(s[l:])
+	}
+
+	c := &_Node{kind: nodeStatic, prefix: s}
+	n.statics = append(n.statics, c)
+	return c
+}
+
+// Ищет роут для оставшейся части пути. Узел n уже сопоставлен.
+// Найденные значения параметров дописываются в params.
+func (n *_Node) lookup(path string, params Params) (*_Node, Params) {
+	if path == "" {
+		if n.route != nil {
+			return n, params
+		}
+	} else {
+		for _, c := range n.statics {
+			if c.prefix[0] == path[0] && strings.HasPrefix(path, c.prefix) {
+				if found, ps := c.lookup(path[len(c.prefix):], params); found != nil {
+					return found, ps
+				}
+			}
+		}
+
+		if len(n.params) > 0 {
+			end := strings.IndexByte(path, '/')
+			if end == -1 {
+				end = len(path)
+			}
+			// пустое значение параметра не допускается
+			if end > 0 {
+				value := path[:end]
+				for _, p := range n.params {
+					if p.constraint != nil && !p.constraint.match(value) {
+						continue
+					}
+					if found, ps := p.lookup(path[end:], append(params, Param{p.prefix, value})); found != nil {
+						return found, ps
+					}
+				}
+			}
+		}
+	}
+
+	// catch-all забирает весь остаток пути, в т.ч. пустой
+	if n.catchAll != nil {
+		return n.catchAll, append(params, Param{n.catchAll.prefix, path})
+	}
+
+	return nil, params
+}
+
+// То же, что lookup, но статические части сравниваются без учета регистра.
+// В fixed накапливается путь с регистром из шаблона.
+func (n *_Node) lookupFold(path string, fixed []byte) ([]byte, bool) {
+	if path == "" {
+		if n.route != nil {
+			return fixed, true
+		}
+	} else {
+		for _, c := range n.statics {
+			if len(path) >= len(c.prefix) && strings.EqualFold(path[:len(c.prefix)], c.prefix) {
+				if f, ok := c.lookupFold(path[len(c.prefix):], append(fixed, c.prefix...)); ok {
+					return f, true
+				}
+			}
+		}
+
+		end := strings.IndexByte(path, '/')
+		if end == -1 {
+			end = len(path)
+		}
+		if end > 0 {
+			value := path[:end]
+			for _, p := range n.params {
+				if p.constraint != nil && !p.constraint.match(value) {
+					continue
+				}
+				if f, ok := p.lookupFold(path[end:], append(fixed, value...)); ok {
+					return f, true
+				}
+			}
+		}
+	}
+
+	if n.catchAll != nil {
+		return append(fixed, path...), true
+	}
+
+	return fixed, false
+}
+
+func commonPrefixLen(a, b string) int {
+	max := len(a)
+	if len(b) < max {
+		max = len(b)
+	}
+	i := 0
+	for i < max && a[i] == b[i] {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,150 @@
+package hollander
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type _NamedRoute struct {
+	template string
+	tokens   []_Token
+}
+
+func (router *NanoRouter) HandleNamed(name, method, path string, h http.Handler) {
+	router.Handle(method, path, h)
+	router.setName(name, path)
+}
+
+func (router *NanoRouter) HandleFuncNamed(name, method, path string, h http.HandlerFunc) {
+	router.HandleFunc(method, path, h)
+	router.setName(name, path)
+}
+
+func (g *RouteGroup) ServeNamed(name, method, path string, handlers ...HttpHandler) *Middleware {
+	mw := g.Serve(method, path, handlers...)
+	g.router.setName(name, g.prefix+path)
+	return mw
+}
+
+func (router *NanoRouter) setName(name, template string) {
+	if name == "" {
+		panic("route name is empty")
+	}
+	tokens, err := parseTemplate(template)
+	if err != nil {
+		panic(err) // Handle уже проверил шаблон
+	}
+
+	router.update(func(t *_RouteTable) {
+		if nr, dup := t.names[name]; dup && nr.template != template {
+			panic(fmt.Sprintf("route name '%s' is already used for %s", name, nr.template))
+		}
+		if t.names == nil {
+			t.names = make(map[string]*_NamedRoute)
+		}
+		t.names[name] = &_NamedRoute{template: template, tokens: tokens}
+	})
+}
+
+/*
+	Строит URL (путь и query) для роута, зарегистрированного под именем name.
+	params - пары ключ-значение: ключи, совпадающие с параметрами шаблона, подставляются в путь (с экранированием),
+	остальные добавляются в query. Значение :param должно быть непустым и без '/', иначе возвращается ошибка.
+
+	router.HandleNamed("order", http.MethodGet, "/suppliers/:supplierId/orders/:orderId", h)
+	router.URL("order", "supplierId", "7", "orderId", "a b", "expand", "items") // /suppliers/7/orders/a%20b?expand=items
+
+	Если имя не найдено в роутере, ищется в смонтированных *NanoRouter, и к результату добавляется префикс монтирования.
+*/
+func (router *NanoRouter) URL(name string, params ...string) (string, error) {
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("route '%s': odd number of params, expected key-value pairs", name)
+	}
+
+	t := router.load()
+	if nr := t.names[name]; nr != nil {
+		return nr.build(params)
+	}
+
+	for _, m := range t.mounts() {
+		if sub, ok := m.h.(*NanoRouter); ok {
+			if u, err := sub.URL(name, params...); err == nil {
+				return m.escapedPrefix + u, nil
+			} else if _, notFound := err.(*_UnknownRouteError); !notFound {
+				return "", err
+			}
+		}
+	}
+
+	return "", &_UnknownRouteError{name}
+}
+
+type _UnknownRouteError struct {
+	name string
+}
+
+func (e *_UnknownRouteError) Error() string {
+	return fmt.Sprintf("route '%s' not found", e.name)
+}
+
+func (nr *_NamedRoute) build(params []string) (string, error) {
+	used := make([]bool, len(params)/2)
+	value := func(name string) (string, bool) {
+		for i := 0; i < len(params); i += 2 {
+			if params[i] == name {
+				used[i/2] = true
+				return params[i+1], true
+			}
+		}
+		return "", false
+	}
+
+	var sb strings.Builder
+	for _, tok := range nr.tokens {
+		switch tok.kind {
+		case nodeStatic:
+			writeEscapedPath(&sb, tok.value)
+		case nodeParam:
+			v, found := value(tok.value)
+			if !found || v == "" {
+				return "", fmt.Errorf("route %s: missing parameter '%s'", nr.template, tok.value)
+			}
+			if strings.Contains(v, "/") {
+				return "", fmt.Errorf("route %s: parameter '%s=%s' should be a single path segment", nr.template, tok.value, v)
+			}
+			if tok.constraint != nil && !tok.constraint.match(v) {
+				return "", fmt.Errorf("route %s: parameter '%s=%s' does not satisfy <%s>", nr.template, tok.value, v, tok.constraint.source)
+			}
+			sb.WriteString(url.PathEscape(v))
+		case nodeCatchAll:
+			// catch-all может быть пустым, слэши в нем сохраняются
+			v, _ := value(tok.value)
+			writeEscapedPath(&sb, v)
+		}
+	}
+
+	query := url.Values{}
+	for i := 0; i < len(params); i += 2 {
+		if !used[i/2] {
+			query.Add(params[i], params[i+1])
+		}
+	}
+	if len(query) > 0 {
+		sb.WriteByte('?')
+		sb.WriteString(query.Encode())
+	}
+
+	return sb.String(), nil
+}
+
+// Экранирует каждый сегмент пути по отдельности, сохраняя слэши между ними
+func writeEscapedPath(sb *strings.Builder, p string) {
+	for i, segment := range strings.Split(p, "/") {
+		if i > 0 {
+			sb.WriteByte('/')
+		}
+		sb.WriteString(url.PathEscape(segment))
+	}
+}
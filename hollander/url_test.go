@@ -0,0 +1,68 @@
+package hollander
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNanoRouter_URL(t *testing.T) {
+	void := func(http.ResponseWriter, *http.Request) {}
+
+	billing := NewRouter()
+	billing.HandleFuncNamed("invoice", "GET", "/invoices/:id<int>", void)
+
+	router := NewRouter()
+	router.HandleFuncNamed("order", "GET", "/suppliers/:supplierId/orders/:orderId", void)
+	router.HandleFuncNamed("orders", "GET", "/orders", void)
+	router.HandleFuncNamed("file", "GET", "/files/*path", void)
+	router.HandleFuncNamed("report", "GET", "/reports/q 1/:id", void)
+	router.Group("/api").ServeNamed("stock", "GET", "/stocks/:id")
+	router.Mount("/billing", billing)
+
+	tests := []struct {
+		name        string
+		params      []string
+		expected    string
+		expectedErr bool
+	}{
+		{"order", []string{"supplierId", "7", "orderId", "a b"}, "/suppliers/7/orders/a%20b", false},
+		{"order", []string{"supplierId", "7", "orderId", "a/b"}, "", true},
+		{"order", []string{"orderId", "1", "supplierId", "2", "expand", "items", "a", "1&2"}, "/suppliers/2/orders/1?a=1%262&expand=items", false},
+		{"orders", nil, "/orders", false},
+		{"file", []string{"path", "dir/a b.txt"}, "/files/dir/a%20b.txt", false},
+		{"file", nil, "/files/", false},
+		{"report", []string{"id", "5"}, "/reports/q%201/5", false},
+		{"stock", []string{"id", "5"}, "/api/stocks/5", false},
+		{"invoice", []string{"id", "5"}, "/billing/invoices/5", false},
+		{"invoice", []string{"id", "x"}, "", true},
+		{"order", []string{"supplierId", "7"}, "", true},
+		{"order", []string{"supplierId", "7", "orderId", ""}, "", true},
+		{"order", []string{"supplierId"}, "", true},
+		{"unknown", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := router.URL(tt.name, tt.params...)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("got error %v, expected error: %v", err, tt.expectedErr)
+			}
+			if got != tt.expected {
+				t.Errorf("got '%s', want '%s'", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNanoRouter_DuplicateName(t *testing.T) {
+	router := NewRouter()
+	router.HandleFuncNamed("a", "GET", "/a", func(http.ResponseWriter, *http.Request) {})
+	// тот же шаблон другим методом - допустимо
+	router.HandleFuncNamed("a", "POST", "/a", func(http.ResponseWriter, *http.Request) {})
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic on duplicate route name")
+		}
+	}()
+	router.HandleFuncNamed("a", "GET", "/b", func(http.ResponseWriter, *http.Request) {})
+}
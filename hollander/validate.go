@@ -0,0 +1,301 @@
+package hollander
+
+import (
+	"errors"
+	"fmt"
+	"regexp/syntax"
+	"sort"
+	"strings"
+)
+
+/*
+	Проверяет таблицу роутов и возвращает все найденные проблемы:
+
+	- повторная регистрация метода и шаблона через Handle (предыдущий хендлер молча заменен);
+	- статический роут перекрывает роут с параметрами, но не обслуживает часть его методов:
+	  статика приоритетнее, поэтому такие запросы получат 405 вместо хендлера роута с параметрами
+	  (перекрытие с теми же методами - штатный приоритет статики, проблемой не считается);
+	- роут с параметрами, вероятно, недостижим: путь, построенный по его шаблону, обслуживает другой роут,
+	  либо ограничение параметра не может совпасть с сегментом пути.
+
+	Роуты смонтированных *NanoRouter проверяются рекурсивно.
+*/
+func (router *NanoRouter) Validate() []error {
+	return router.load().validate("")
+}
+
+/*
+	Strict: проблемы, в которых участвует только что зарегистрированный роут added (или монтирование).
+	Вся таблица не перепроверяется, чтобы регистрация не становилась все дороже с ростом числа роутов,
+	поэтому проблемы, появившиеся до включения Strict, показывает только Validate.
+*/
+func (router *NanoRouter) checkStrict(t *_RouteTable, added *_Route) {
+	if !router.Strict {
+		return
+	}
+	if problems := t.validateRoute(added); len(problems) > 0 {
+		msgs := make([]string, len(problems))
+		for i, p := range problems {
+			msgs[i] = p.Error()
+		}
+		panic("strict router: " + strings.Join(msgs, "; "))
+	}
+}
+
+func (t *_RouteTable) validate(prefix string) []error {
+	var problems []error
+
+	for _, d := range t.duplicates {
+		method, template, _ := strings.Cut(d, " ")
+		problems = append(problems, fmt.Errorf("%s %s%s: registered more than once", method, prefix, template))
+	}
+
+	for _, path := range t.sortedStatics() {
+		if _, err := t.checkShadow(prefix, path); err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	if t.paramRoutes != nil {
+		depth := t.maxParamSegments()
+		for _, rt := range t.sortedParamRoutes() {
+			if rt.mount != nil {
+				if sub, ok := rt.mount.h.(*NanoRouter); ok {
+					problems = append(problems, sub.load().validate(prefix+rt.mount.prefix)...)
+				}
+				continue
+			}
+			if _, err := t.checkReachable(rt, depth); err != nil {
+				problems = append(problems, fmt.Errorf("%s%s: %s", prefix, rt.template, err))
+			}
+		}
+	}
+
+	return problems
+}
+
+// Как validate, но только проблемы, в которых участвует added
+func (t *_RouteTable) validateRoute(added *_Route) []error {
+	var problems []error
+	if added.mount != nil {
+		if sub, ok := added.mount.h.(*NanoRouter); ok {
+			problems = append(problems, sub.load().validate(added.mount.prefix)...)
+		}
+	}
+	if t.paramRoutes == nil {
+		return problems
+	}
+
+	// статика перекрывает роут с параметрами: added с любой из сторон
+	if t.staticRoutes[added.template] == added {
+		if _, err := t.checkShadow("", added.template); err != nil {
+			problems = append(problems, err)
+		}
+	} else {
+		for _, path := range t.sortedStatics() {
+			if shadowed, err := t.checkShadow("", path); err != nil && shadowed == added {
+				problems = append(problems, err)
+			}
+		}
+	}
+
+	// сам added недостижим или забирает пути у других роутов
+	depth := t.maxParamSegments()
+	for _, rt := range t.sortedParamRoutes() {
+		if rt.mount != nil {
+			continue
+		}
+		if found, err := t.checkReachable(rt, depth); err != nil && (rt == added || found == added) {
+			problems = append(problems, fmt.Errorf("%s: %s", rt.template, err))
+		}
+	}
+	return problems
+}
+
+func (t *_RouteTable) sortedStatics() []string {
+	var statics []string
+	for path, rt := range t.staticRoutes {
+		if rt.mount == nil {
+			statics = append(statics, path)
+		}
+	}
+	sort.Strings(statics)
+	return statics
+}
+
+func (t *_RouteTable) sortedParamRoutes() []*_Route {
+	var routes []*_Route
+	if t.paramRoutes != nil {
+		t.paramRoutes.walk(func(n *_Node) {
+			if n.route != nil {
+				routes = append(routes, n.route)
+			}
+		})
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].template < routes[j].template })
+	return routes
+}
+
+/*
+	Статический роут path перекрывает роут с параметрами, но обслуживает не все его методы.
+	shadowed - перекрытый роут, если он есть
+*/
+func (t *_RouteTable) checkShadow(prefix, path string) (shadowed *_Route, err error) {
+	if t.paramRoutes == nil {
+		return nil, nil
+	}
+	var buf [maxInlineParams]Param
+	node, _ := t.paramRoutes.lookup(path, buf[:0])
+	if node == nil || node.route.mount != nil {
+		return nil, nil
+	}
+	rt := t.staticRoutes[path]
+	var lost []string
+	for _, m := range node.route.registeredMethods() {
+		if rt.handler(m) == nil {
+			lost = append(lost, m)
+		}
+	}
+	if len(lost) == 0 {
+		return node.route, nil
+	}
+	return node.route, fmt.Errorf("%s%s shadows %s%s: %s requests to %s%s get 405",
+		prefix, path, prefix, node.route.template, strings.Join(lost, ", "), prefix, path)
+}
+
+/*
+	Строит путь по шаблону и проверяет, что он приводит к этому же роуту. found - роут, к которому он привел.
+	depth - maxParamSegments таблицы, считается один раз на проверку
+*/
+func (t *_RouteTable) checkReachable(rt *_Route, depth int) (found *_Route, err error) {
+	tokens, err := parseTemplate(rt.template)
+	if err != nil {
+		return nil, err
+	}
+
+	var sb strings.Builder
+	for _, tok := range tokens {
+		switch tok.kind {
+		case nodeStatic:
+			sb.WriteString(tok.value)
+		case nodeParam:
+			sample, err := sampleValue(tok.constraint)
+			if err != nil {
+				return nil, fmt.Errorf("parameter '%s' is probably unreachable: %s", tok.value, err)
+			}
+			sb.WriteString(sample)
+		case nodeCatchAll:
+			// сегментов больше, чем в любом шаблоне с параметрами, чтобы не совпасть ни с одним из них
+			for i := depth; i >= 0; i-- {
+				sb.WriteString(sampleUnconstrained)
+				if i > 0 {
+					sb.WriteByte('/')
+				}
+			}
+		}
+	}
+
+	path := sb.String()
+	var buf [maxInlineParams]Param
+	if found, _ = t.find(path, buf[:0]); found != rt {
+		by := "nothing"
+		if found != nil {
+			by = found.template
+		}
+		return found, fmt.Errorf("probably unreachable: %s is served by %s", path, by)
+	}
+	return found, nil
+}
+
+// Наибольшее число сегментов среди шаблонов роутов с параметрами
+func (t *_RouteTable) maxParamSegments() int {
+	n := 0
+	t.paramRoutes.walk(func(node *_Node) {
+		if node.route != nil {
+			if c := strings.Count(node.route.template, "/"); c > n {
+				n = c
+			}
+		}
+	})
+	return n
+}
+
+// Значение для параметра без ограничения, которое вряд ли совпадет со статикой или ограничениями соседей
+const sampleUnconstrained = "~sample~"
+
+var builtinSamples = map[string]string{
+	"int":  "1",
+	"uuid": "00000000-0000-0000-0000-000000000000",
+}
+
+func sampleValue(c *_Constraint) (string, error) {
+	if c == nil {
+		return sampleUnconstrained, nil
+	}
+	if s, ok := builtinSamples[c.source]; ok {
+		return s, nil
+	}
+
+	re, err := syntax.Parse(c.source, syntax.Perl)
+	if err != nil {
+		return "", err
+	}
+	s := sampleRegexp(re.Simplify())
+	if s == "" || strings.IndexByte(s, '/') != -1 || !c.match(s) {
+		return "", errors.New("constraint <" + c.source + "> does not seem to match a non-empty path segment")
+	}
+	return s, nil
+}
+
+// Какая-нибудь непустая строка, подходящая под выражение, по возможности без '/'
+func sampleRegexp(re *syntax.Regexp) string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return string(re.Rune)
+	case syntax.OpCharClass:
+		if len(re.Rune) == 0 {
+			return ""
+		}
+		// предпочитаем читаемые символы, иначе первый подходящий, но не '/'
+		for _, r := range "a0A_-.~" {
+			for i := 0; i+1 < len(re.Rune); i += 2 {
+				if re.Rune[i] <= r && r <= re.Rune[i+1] {
+					return string(r)
+				}
+			}
+		}
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			for r := re.Rune[i]; r <= re.Rune[i+1] && r < re.Rune[i]+128; r++ {
+				if r != '/' {
+					return string(r)
+				}
+			}
+		}
+		return string(re.Rune[0])
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return "a"
+	case syntax.OpCapture, syntax.OpPlus, syntax.OpStar, syntax.OpQuest:
+		return sampleRegexp(re.Sub[0])
+	case syntax.OpRepeat:
+		n := re.Min
+		if n == 0 && re.Max != 0 {
+			n = 1
+		}
+		return strings.Repeat(sampleRegexp(re.Sub[0]), n)
+	case syntax.OpConcat:
+		var sb strings.Builder
+		for _, sub := range re.Sub {
+			sb.WriteString(sampleRegexp(sub))
+		}
+		return sb.String()
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if s := sampleRegexp(sub); s != "" && strings.IndexByte(s, '/') == -1 {
+				return s
+			}
+		}
+		return sampleRegexp(re.Sub[0])
+	default:
+		return ""
+	}
+}
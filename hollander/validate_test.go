@@ -0,0 +1,120 @@
+package hollander
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNanoRouter_Validate(t *testing.T) {
+	void := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	sub := NewRouter()
+	sub.Handle("GET", "/x", void)
+	sub.Handle("GET", "/x", void)
+
+	router := NewRouter()
+	router.Handle("GET", "/orders/:id", void)
+	router.Handle("DELETE", "/orders/:id", void)
+	router.Handle("GET", "/orders/new", void) // перекрывает DELETE
+	router.Handle("GET", "/stocks/:id", void) // перекрытие с теми же методами - норма
+	router.Handle("GET", "/stocks/summary", void)
+	router.Handle("GET", "/api/:id<int>", void)
+	router.Handle("GET", "/api/:n<[0-9]+>", void) // все, что подходит под [0-9]+, забирает :id<int>
+	router.Handle("GET", "/api/:name", void)
+	router.Handle("GET", "/slash/:p<a/b>", void)
+	router.Handle("GET", "/files/:name", void)
+	router.Handle("GET", "/files/*path", void)
+	router.Handle("GET", "/files/:name/:part", void) // /files/a/b/c все равно достается *path
+	router.Handle("POST", "/dup", void)
+	router.Handle("POST", "/dup", void)
+	router.Replace("POST", "/dup2", void)
+	router.Replace("POST", "/dup2", void)
+	router.Mount("/sub", sub)
+
+	var got []string
+	for _, err := range router.Validate() {
+		got = append(got, err.Error())
+	}
+	expected := []string{
+		"POST /dup: registered more than once",
+		"/orders/new shadows /orders/:id: DELETE requests to /orders/new get 405",
+		"/api/:n<[0-9]+>: probably unreachable: /api/0 is served by /api/:id<int>",
+		"/slash/:p<a/b>: parameter 'p' is probably unreachable: constraint <a/b> does not seem to match a non-empty path segment",
+		"GET /sub/x: registered more than once",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestNanoRouter_Strict(t *testing.T) {
+	void := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	for name, register := range map[string]func(router *NanoRouter){
+		"duplicate":   func(router *NanoRouter) { router.Handle("GET", "/orders/:id", void) },
+		"shadow":      func(router *NanoRouter) { router.Handle("DELETE", "/orders/:id", void) },
+		"unreachable": func(router *NanoRouter) { router.Handle("GET", "/orders/:n<\\d+>", void) },
+		// добавленная статика перекрывает уже зарегистрированный роут с параметрами
+		"static shadows": func(router *NanoRouter) {
+			router.Handle("DELETE", "/stocks/:id", void)
+			router.Handle("GET", "/stocks/new", void)
+		},
+		// добавленная статика забирает единственный путь, которым проверялся старый роут
+		"steals sample": func(router *NanoRouter) {
+			router.Handle("GET", "/users/:id<int>", void)
+			router.Handle("GET", "/users/1", void)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			router := NewRouter()
+			router.Strict = true
+			router.Handle("GET", "/orders/:id<int>", void)
+			router.Handle("GET", "/orders/:id", void)
+			router.Handle("GET", "/orders/new", void)
+			router.Replace("GET", "/orders/:id", void)
+
+			defer func() {
+				if recover() == nil {
+					t.Error("expected panic")
+				}
+				if len(router.Validate()) != 0 {
+					t.Error("failed registration should not change routes")
+				}
+			}()
+			register(router)
+		})
+	}
+}
+
+// Catch-all рядом с параметрами на тех же позициях достижим глубже них, Strict не должен паниковать
+func TestNanoRouter_StrictCatchAll(t *testing.T) {
+	router := NewRouter()
+	router.Strict = true
+	router.HandleFunc("GET", "/files/*rest", replyText("rest"))
+	router.HandleFunc("GET", "/files/:a/:b", replyText("ab"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/a/b/c", nil))
+	if w.Body.String() != "rest" {
+		t.Errorf("got '%s', want 'rest'", w.Body.String())
+	}
+}
+
+// Remove и Replace снимают запись о дубликате
+func TestNanoRouter_ValidateAfterRemove(t *testing.T) {
+	void := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	router := NewRouter()
+	router.Handle("GET", "/a", void)
+	router.Handle("GET", "/a", void)
+	router.Remove("GET", "/a")
+	router.Handle("GET", "/b", void)
+	router.Handle("GET", "/b", void)
+	router.Replace("GET", "/b", void)
+
+	if errs := router.Validate(); len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}